@@ -0,0 +1,82 @@
+// Package batch 生成代码使用的批量接口结果
+package batch
+
+import (
+	"github.com/nzlov/gorm"
+)
+
+// 批量接口的模式 Batch:mode=partial
+const (
+	Atomic  = "atomic"  // 全部成功或全部失败
+	Partial = "partial" // 跳过失败的数据
+)
+
+// Error 单条数据的错误 Index 为请求数组中的下标
+type Error struct {
+	Index   int         `json:"index"`
+	Message interface{} `json:"message"`
+}
+
+// Result 批量接口的结果
+type Result struct {
+	Total    int         `json:"total"`
+	Success  int         `json:"success"`
+	Errors   []Error     `json:"errors"`
+	Warnings []Error     `json:"warnings"` // 提交后 After Func 的错误 数据已保存
+	Items    interface{} `json:"items"`    // 成功的数据
+
+	failed map[int]bool
+}
+
+// NewResult n为请求中的数据条数
+func NewResult(n int) *Result {
+	return &Result{
+		Total:    n,
+		Errors:   []Error{},
+		Warnings: []Error{},
+		failed:   map[int]bool{},
+	}
+}
+
+// Fail 记录第i条数据的错误 msg 为 error 时使用 Error()
+func (r *Result) Fail(i int, msg interface{}) []Error {
+	if err, ok := msg.(error); ok {
+		msg = err.Error()
+	}
+	r.failed[i] = true
+	r.Errors = append(r.Errors, Error{Index: i, Message: msg})
+	return r.Errors
+}
+
+// Warn 记录第i条数据已保存后的错误 不影响成功状态
+func (r *Result) Warn(i int, msg interface{}) {
+	if err, ok := msg.(error); ok {
+		msg = err.Error()
+	}
+	r.Warnings = append(r.Warnings, Error{Index: i, Message: msg})
+}
+
+// Failed 第i条数据是否已经失败
+func (r *Result) Failed(i int) bool {
+	return r.failed[i]
+}
+
+// HasError 是否存在失败的数据
+func (r *Result) HasError() bool {
+	return len(r.Errors) > 0
+}
+
+// SavePoint 在事务中创建保存点 partial 模式下单条失败时回滚到保存点
+func SavePoint(db *gorm.DB) error {
+	return db.Exec("SAVEPOINT tg_batch").Error
+}
+
+// RollbackTo 回滚到保存点
+func RollbackTo(db *gorm.DB) error {
+	return db.Exec("ROLLBACK TO SAVEPOINT tg_batch").Error
+}
+
+// Release 释放保存点
+func Release(db *gorm.DB) error {
+	return db.Exec("RELEASE SAVEPOINT tg_batch").Error
+}
@@ -0,0 +1,24 @@
+package batch
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResult(t *testing.T) {
+	r := NewResult(3)
+	r.Fail(1, errors.New("bad"))
+	r.Warn(2, "after")
+	if !r.Failed(1) || r.Failed(2) || !r.HasError() {
+		t.Fatalf("failed %v", r.failed)
+	}
+	if len(r.Errors) != 1 || r.Errors[0].Index != 1 || r.Errors[0].Message != "bad" {
+		t.Fatalf("errors %v", r.Errors)
+	}
+	if len(r.Warnings) != 1 || r.Warnings[0].Index != 2 || r.Warnings[0].Message != "after" {
+		t.Fatalf("warnings %v", r.Warnings)
+	}
+	if NewResult(1).HasError() {
+		t.Fatal("empty result has error")
+	}
+}
@@ -0,0 +1,272 @@
+// Package bind 生成代码使用的复合类型参数解析
+package bind
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Slice 解析切片参数 v为切片的指针
+// format 为 multi 时读取重复的 key, 为 csv 时按逗号分隔
+func Slice(form url.Values, key, format string, v interface{}) error {
+	vs, ok := form[key]
+	if !ok {
+		return nil
+	}
+	if format == "csv" {
+		ss := []string{}
+		for _, s := range vs {
+			if s == "" {
+				continue
+			}
+			ss = append(ss, strings.Split(s, ",")...)
+		}
+		vs = ss
+	}
+
+	rv := reflect.ValueOf(v).Elem()
+	if rv.Kind() == reflect.Ptr {
+		p := reflect.New(rv.Type().Elem())
+		rv.Set(p)
+		rv = p.Elem()
+	}
+	s := reflect.MakeSlice(rv.Type(), 0, len(vs))
+	for _, x := range vs {
+		e := reflect.New(rv.Type().Elem()).Elem()
+		if err := set(e, strings.TrimSpace(x)); err != nil {
+			return fmt.Errorf("%s: %s", key, err)
+		}
+		s = reflect.Append(s, e)
+	}
+	rv.Set(s)
+	return nil
+}
+
+// JSON 解析 json 编码的参数 v为指针
+func JSON(form url.Values, key string, v interface{}) error {
+	vs, ok := form[key]
+	if !ok || len(vs) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(vs[0]), v); err != nil {
+		return fmt.Errorf("%s: %s", key, err)
+	}
+	return nil
+}
+
+func set(e reflect.Value, s string) error {
+	switch e.Kind() {
+	case reflect.String:
+		e.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		e.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, e.Type().Bits())
+		if err != nil {
+			return err
+		}
+		e.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(s, 10, e.Type().Bits())
+		if err != nil {
+			return err
+		}
+		e.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, e.Type().Bits())
+		if err != nil {
+			return err
+		}
+		e.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", e.Type())
+	}
+	return nil
+}
+
+// Time 解析时间参数 v为 **time.Time 或 ***time.Time
+func Time(form url.Values, key, format, tz string, v interface{}) error {
+	vs, ok := form[key]
+	if !ok || len(vs) == 0 {
+		return nil
+	}
+	return setTime(vs[0], key, format, tz, v)
+}
+
+// RawTime 解析 json 请求体中的时间 字符串或数字 不存在或为 null 时忽略
+func RawTime(raw json.RawMessage, key, format, tz string, v interface{}) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	s := string(raw)
+	if strings.HasPrefix(s, "\"") {
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return fmt.Errorf("%s: %s", key, err)
+		}
+	}
+	return setTime(s, key, format, tz, v)
+}
+
+func setTime(s, key, format, tz string, v interface{}) error {
+	t, err := ParseTime(s, format, tz)
+	if err != nil {
+		return fmt.Errorf("%s: %s", key, err)
+	}
+	switch p := v.(type) {
+	case **time.Time:
+		*p = &t
+	case ***time.Time:
+		pt := &t
+		*p = &pt
+	default:
+		return fmt.Errorf("%s: unsupported type %T", key, v)
+	}
+	return nil
+}
+
+// ParseTime 按 format 解析时间 tz为时区 默认为本地时区
+// format: rfc3339(默认) unix unixmilli date 或自定义 layout, s 为 now 时返回当前时间
+func ParseTime(s, format, tz string) (time.Time, error) {
+	loc := time.Local
+	if tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return time.Time{}, err
+		}
+		loc = l
+	}
+	if s == "now" {
+		return time.Now().In(loc), nil
+	}
+	switch format {
+	case "", "rfc3339":
+		return time.ParseInLocation(time.RFC3339, s, loc)
+	case "date":
+		return time.ParseInLocation("2006-01-02", s, loc)
+	case "unix", "unixmilli":
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if format == "unix" {
+			return time.Unix(n, 0).In(loc), nil
+		}
+		return time.Unix(n/1000, n%1000*int64(time.Millisecond)).In(loc), nil
+	}
+	return time.ParseInLocation(format, s, loc)
+}
+
+// MustParseTime 与 ParseTime 相同 解析失败时 panic 用于生成代码中的常量
+func MustParseTime(s, format, tz string) time.Time {
+	t, err := ParseTime(s, format, tz)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Null 参数存在且为空 用于 null:"true" 的字段
+func Null(form url.Values, key string) bool {
+	vs, ok := form[key]
+	return ok && (len(vs) == 0 || vs[0] == "")
+}
+
+// Nulls 返回 json 请求体中值为 null 的 key
+func Nulls(data []byte, keys ...string) []string {
+	m := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	ns := []string{}
+	for _, k := range keys {
+		if v, ok := m[k]; ok && string(v) == "null" {
+			ns = append(ns, k)
+		}
+	}
+	return ns
+}
+
+// ChangedKey 更新接口 mode=patch 时请求中存在的字段名 保存在 ctx 中
+const ChangedKey = "tg.changed"
+
+// Changed 读取 ctx 中的变更字段名 用于 Update 的 Func
+func Changed(c interface{ Get(string) interface{} }) []string {
+	fs, _ := c.Get(ChangedKey).([]string)
+	return fs
+}
+
+// IDsKey 按条件更新时匹配数据的主键 保存在 ctx 中 复合主键以 / 连接
+const IDsKey = "tg.ids"
+
+// IDs 读取 ctx 中匹配数据的主键 用于 UpdateFilter 中的 Update Func
+func IDs(c interface{ Get(string) interface{} }) []string {
+	ids, _ := c.Get(IDsKey).([]string)
+	return ids
+}
+
+// Versions 解析版本号 参数或 If-Match 以逗号分隔 支持 1 "1" W/"1,2"
+func Versions(s string) ([]int64, error) {
+	vs := []int64{}
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		v = strings.TrimPrefix(v, "W/")
+		v = strings.Trim(v, "\"")
+		if v == "" {
+			continue
+		}
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		vs = append(vs, i)
+	}
+	return vs, nil
+}
+
+// ETag 版本号对应的 ETag 多个版本号时为弱 ETag W/"1,2"
+func ETag(versions ...int64) string {
+	if len(versions) == 1 {
+		return fmt.Sprintf("%q", strconv.FormatInt(versions[0], 10))
+	}
+	vs := make([]string, len(versions))
+	for i, v := range versions {
+		vs[i] = strconv.FormatInt(v, 10)
+	}
+	return "W/" + fmt.Sprintf("%q", strings.Join(vs, ","))
+}
+
+// Key 解析路径中的主键 v为主键字段的指针
+// 支持整数 字符串 及实现 encoding.TextUnmarshaler 的类型 例如 uuid.UUID
+func Key(s string, v interface{}) error {
+	if u, ok := v.(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	e := reflect.ValueOf(v)
+	if e.Kind() != reflect.Ptr {
+		return fmt.Errorf("unsupported type %T", v)
+	}
+	return set(e.Elem(), s)
+}
+
+// Missing 返回 json 对象中不存在或为 null 的 key
+func Missing(data []byte, keys ...string) []string {
+	m := map[string]json.RawMessage{}
+	json.Unmarshal(data, &m)
+	ms := []string{}
+	for _, k := range keys {
+		if v, ok := m[k]; !ok || string(v) == "null" {
+			ms = append(ms, k)
+		}
+	}
+	return ms
+}
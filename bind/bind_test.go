@@ -0,0 +1,239 @@
+package bind
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSlice(t *testing.T) {
+	form := url.Values{"a": {"1,2", "", "3"}, "b": {"1", "2"}, "c": {"x"}, "d": {"a, b"}}
+	tests := []struct {
+		key, format string
+		v, want     interface{}
+		err         bool
+	}{
+		{"a", "csv", &[]int64{}, &[]int64{1, 2, 3}, false},
+		{"b", "multi", &[]uint{}, &[]uint{1, 2}, false},
+		{"c", "multi", &[]int{}, &[]int{}, true},
+		{"d", "csv", &[]string{}, &[]string{"a", "b"}, false},
+		{"x", "csv", &[]string{}, &[]string{}, false},
+		{"b", "multi", &[]struct{}{}, &[]struct{}{}, true},
+	}
+	for _, tt := range tests {
+		err := Slice(form, tt.key, tt.format, tt.v)
+		if (err != nil) != tt.err {
+			t.Fatalf("%s: err %v", tt.key, err)
+		}
+		if !tt.err && !reflect.DeepEqual(tt.v, tt.want) {
+			t.Fatalf("%s: want %v got %v", tt.key, tt.want, tt.v)
+		}
+	}
+
+	type status string
+	var ss []status
+	if err := Slice(url.Values{"a": {"x,y"}}, "a", "csv", &ss); err != nil || !reflect.DeepEqual(ss, []status{"x", "y"}) {
+		t.Fatalf("named slice: %v %v", err, ss)
+	}
+
+	var p *[]float64
+	if err := Slice(url.Values{"a": {"1.5"}}, "a", "multi", &p); err != nil || p == nil || (*p)[0] != 1.5 {
+		t.Fatalf("pointer slice: %v %v", err, p)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var m map[string]int
+	if err := JSON(url.Values{"a": {`{"x":1}`}}, "a", &m); err != nil || m["x"] != 1 {
+		t.Fatalf("got %v %v", m, err)
+	}
+	if err := JSON(url.Values{"a": {`{`}}, "a", &m); err == nil {
+		t.Fatal("want error")
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	sh, _ := time.LoadLocation("Asia/Shanghai")
+	tests := []struct {
+		s, format, tz string
+		want          time.Time
+		err           bool
+	}{
+		{"2020-01-02T03:04:05Z", "", "", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), false},
+		{"2020-01-02T03:04:05+08:00", "rfc3339", "", time.Date(2020, 1, 2, 3, 4, 5, 0, sh), false},
+		{"2020-01-02", "date", "Asia/Shanghai", time.Date(2020, 1, 2, 0, 0, 0, 0, sh), false},
+		{"1577934245", "unix", "UTC", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), false},
+		{"1577934245123", "unixmilli", "UTC", time.Date(2020, 1, 2, 3, 4, 5, 123000000, time.UTC), false},
+		{"2020/01/02", "2006/01/02", "UTC", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), false},
+		{"x", "unix", "", time.Time{}, true},
+		{"2020-01-02", "", "", time.Time{}, true},
+		{"2020-01-02", "date", "Nowhere/City", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTime(tt.s, tt.format, tt.tz)
+		if (err != nil) != tt.err {
+			t.Fatalf("%s %s: err %v", tt.s, tt.format, err)
+		}
+		if !tt.err && !got.Equal(tt.want) {
+			t.Fatalf("%s %s: want %v got %v", tt.s, tt.format, tt.want, got)
+		}
+	}
+	if n, err := ParseTime("now", "date", "UTC"); err != nil || time.Since(n) > time.Minute {
+		t.Fatalf("now: %v %v", n, err)
+	}
+}
+
+func TestMustParseTime(t *testing.T) {
+	if got := MustParseTime("2020-01-02", "date", "UTC"); !got.Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("got %v", got)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("want panic")
+		}
+	}()
+	MustParseTime("x", "date", "")
+}
+
+func TestTime(t *testing.T) {
+	var p *time.Time
+	if err := Time(url.Values{"a": {"2020-01-02"}}, "a", "date", "UTC", &p); err != nil || p == nil || p.Day() != 2 {
+		t.Fatalf("got %v %v", p, err)
+	}
+	var pp **time.Time
+	if err := Time(url.Values{"a": {"2020-01-02"}}, "a", "date", "UTC", &pp); err != nil || pp == nil || (*pp).Day() != 2 {
+		t.Fatalf("got %v %v", pp, err)
+	}
+	var x time.Time
+	if err := Time(url.Values{"a": {"2020-01-02"}}, "a", "date", "UTC", &x); err == nil {
+		t.Fatal("want error")
+	}
+}
+
+func TestRawTime(t *testing.T) {
+	tests := []struct {
+		raw    string
+		format string
+		want   time.Time
+		err    bool
+	}{
+		{`"2020-01-02"`, "date", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), false},
+		{`1577934245`, "unix", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), false},
+		{`"1577934245"`, "unix", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), false},
+		{`null`, "date", time.Time{}, false},
+		{``, "date", time.Time{}, false},
+		{`"x"`, "date", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		var p *time.Time
+		err := RawTime([]byte(tt.raw), "a", tt.format, "UTC", &p)
+		if (err != nil) != tt.err {
+			t.Fatalf("%s: err %v", tt.raw, err)
+		}
+		if tt.err {
+			continue
+		}
+		if tt.want.IsZero() {
+			if p != nil {
+				t.Fatalf("%s: want nil got %v", tt.raw, p)
+			}
+			continue
+		}
+		if p == nil || !p.Equal(tt.want) {
+			t.Fatalf("%s: want %v got %v", tt.raw, tt.want, p)
+		}
+	}
+}
+
+func TestVersions(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []int64
+		err  bool
+	}{
+		{"1", []int64{1}, false},
+		{`"1"`, []int64{1}, false},
+		{`W/"1,2"`, []int64{1, 2}, false},
+		{"1, 2,", []int64{1, 2}, false},
+		{"", []int64{}, false},
+		{"a", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := Versions(tt.s)
+		if (err != nil) != tt.err {
+			t.Fatalf("%q: err %v", tt.s, err)
+		}
+		if !tt.err && !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%q: want %v got %v", tt.s, tt.want, got)
+		}
+	}
+}
+
+func TestETag(t *testing.T) {
+	if s := ETag(1); s != `"1"` {
+		t.Fatalf("got %s", s)
+	}
+	if s := ETag(1, 2); s != `W/"1,2"` {
+		t.Fatalf("got %s", s)
+	}
+	vs, err := Versions(ETag(3, 4))
+	if err != nil || !reflect.DeepEqual(vs, []int64{3, 4}) {
+		t.Fatalf("round trip: %v %v", vs, err)
+	}
+}
+
+type text string
+
+func (t *text) UnmarshalText(b []byte) error {
+	*t = text("t:" + string(b))
+	return nil
+}
+
+func TestKey(t *testing.T) {
+	var i uint
+	if err := Key("12", &i); err != nil || i != 12 {
+		t.Fatalf("got %v %v", i, err)
+	}
+	if err := Key("-1", &i); err == nil {
+		t.Fatal("want error")
+	}
+	var s string
+	if err := Key("a", &s); err != nil || s != "a" {
+		t.Fatalf("got %v %v", s, err)
+	}
+	var x text
+	if err := Key("a", &x); err != nil || x != "t:a" {
+		t.Fatalf("got %v %v", x, err)
+	}
+	if err := Key("1", i); err == nil {
+		t.Fatal("want error")
+	}
+}
+
+func TestNullsMissing(t *testing.T) {
+	data := []byte(`{"a":null,"b":1,"c":""}`)
+	if ns := Nulls(data, "a", "b", "d"); !reflect.DeepEqual(ns, []string{"a"}) {
+		t.Fatalf("nulls %v", ns)
+	}
+	if ms := Missing(data, "a", "b", "c", "d"); !reflect.DeepEqual(ms, []string{"a", "d"}) {
+		t.Fatalf("missing %v", ms)
+	}
+	if !Null(url.Values{"a": {""}}, "a") || Null(url.Values{"a": {"1"}}, "a") || Null(url.Values{}, "a") {
+		t.Fatal("null")
+	}
+}
+
+type getter map[string]interface{}
+
+func (g getter) Get(k string) interface{} { return g[k] }
+
+func TestChangedIDs(t *testing.T) {
+	g := getter{ChangedKey: []string{"name"}, IDsKey: []string{"1", "2"}}
+	if !reflect.DeepEqual(Changed(g), []string{"name"}) || !reflect.DeepEqual(IDs(g), []string{"1", "2"}) {
+		t.Fatal("changed ids")
+	}
+	if Changed(getter{}) != nil {
+		t.Fatal("empty changed")
+	}
+}
@@ -3,15 +3,34 @@ package generate
 import (
 	"go/ast"
 	"go/token"
+	"go/types"
 	"reflect"
 	"strconv"
 	"strings"
 
+	"github.com/nzlov/gorm"
 	"github.com/sirupsen/logrus"
 )
 
 func (f *File) genDecl(node ast.Node) bool {
 	switch t := node.(type) {
+	case *ast.File:
+		if f.external {
+			return true
+		}
+		// 包默认注解只从包注释或 tg.go 中读取
+		cs := []*ast.CommentGroup{t.Doc}
+		if f.name == "tg.go" {
+			cs = t.Comments
+		}
+		for _, c := range cs {
+			for _, l := range strings.Split(c.Text(), "\n") {
+				if strings.HasPrefix(l, "@tg-default ") {
+					f.pkg.Default = append(f.pkg.Default, parseDefault(l[len("@tg-default "):])...)
+				}
+			}
+		}
+		return true
 	case *ast.GenDecl:
 		switch t.Tok {
 		case token.IMPORT:
@@ -20,197 +39,802 @@ func (f *File) genDecl(node ast.Node) bool {
 				f.imp = append(f.imp, ispec.Path.Value)
 			}
 		case token.TYPE:
-			if t.Doc != nil {
-				if strings.HasPrefix(t.Doc.Text(), "@tg") {
-					m := Mapper{
-						File: f,
-						API:  strings.TrimSpace(t.Doc.Text()),
-						Attr: []Attr{},
-					}
-					for _, spec := range t.Specs {
-						switch st := spec.(type) {
-						case *ast.TypeSpec:
-							m.Name = st.Name.String()
-							switch stf := st.Type.(type) {
-							case *ast.StructType:
-								for _, field := range stf.Fields.List {
-									switch ft := field.Type.(type) {
-									case *ast.Ident:
-										at := Attr{}
-										at.Name = strings.TrimSpace(field.Names[0].Name)
-										if field.Tag == nil {
-											logrus.Debugf("%s:%s not found tag", m.Name, at.Name)
-											continue
-										}
-										structTag := reflect.StructTag(strings.Replace(field.Tag.Value, "`", "", -1))
-
-										if v, ok := structTag.Lookup("dbindex"); ok {
-											m.DBIndex = v
-										}
-
-										at.Params = structTag.Get("params")
-										if at.Params == "" {
-											logrus.Debugf("%s:%s not found params", m.Name, at.Name)
-											continue
-										}
-
-										at.JSON = structTag.Get("json")
-										if at.JSON == "" || at.JSON == "-" {
-											at.JSON = strings.ToLower(at.Name)
-										}
-										at.Enums = structTag.Get("enums")
-										at.MaxLength = structTag.Get("maxlength")
-										at.MinLength = structTag.Get("minlength")
-										at.Max = structTag.Get("max")
-										at.Min = structTag.Get("min")
-
-										switch ft.Name {
-										case "bool":
-											at.Type = "bool"
-											at.CtxFunc = "Bool"
-										case "int", "int8", "int16", "int32", "int64":
-											at.Type = "integer"
-											at.CtxFunc = "Int64"
-										case "float32", "float64":
-											at.Type = "number"
-											at.CtxFunc = "Float64"
-										default:
-											at.Type = "string"
-											at.CtxFunc = "String"
-										}
-										if v, ok := structTag.Lookup("pt"); ok {
-											vs := strings.Split(v, ":")
-											at.Type = vs[0]
-											if len(vs) > 1 {
-												if strings.HasPrefix(vs[1], "@") {
-													at.CtxFunc = "@"
-													at.IToM = vs[1][1:]
-												} else {
-													at.CtxFunc = vs[1]
-												}
-											}
-										}
-										if field.Doc != nil {
-											at.Desc = strings.TrimSpace(field.Doc.Text())
-										} else {
-											at.Desc = strings.TrimSpace(at.Name)
-										}
-										logrus.Debugln(m.Name, "Add Attr:", at.Name, at.Type, at.CtxFunc)
-										m.Attr = append(m.Attr, at)
-									default:
-										at := Attr{}
-										if field.Names == nil {
-											continue
-										}
-										at.Name = strings.TrimSpace(field.Names[0].Name)
-										if field.Tag == nil {
-											logrus.Debugf("%s:%s not found tag", m.Name, at.Name)
-											continue
-										}
-										structTag := reflect.StructTag(strings.Replace(field.Tag.Value, "`", "", -1))
-
-										if v, ok := structTag.Lookup("dbindex"); ok {
-											m.DBIndex = v
-										}
-
-										at.Params = structTag.Get("params")
-										if at.Params == "" {
-											logrus.Debugf("%s:%s not found params", m.Name, at.Name)
-											continue
-										}
-
-										at.JSON = structTag.Get("json")
-										at.Enums = structTag.Get("enums")
-										at.MaxLength = structTag.Get("maxlength")
-										at.MinLength = structTag.Get("minlength")
-										at.Max = structTag.Get("max")
-										at.Min = structTag.Get("min")
-
-										if v, ok := structTag.Lookup("pt"); ok {
-											vs := strings.Split(v, ":")
-											if len(vs) != 2 {
-												logrus.Debugf("%s:%s param type error:%s", m.Name, at.Name, v)
-												continue
-											}
-											at.Type = vs[0]
-											if strings.HasPrefix(vs[1], "@") {
-												at.CtxFunc = "@"
-												at.IToM = vs[1][1:]
-											} else {
-												at.CtxFunc = vs[1]
-											}
-										}
-										if field.Doc != nil {
-											at.Desc = strings.TrimSpace(field.Doc.Text())
-										} else {
-											at.Desc = strings.TrimSpace(at.Name)
-										}
-										logrus.Debugln(m.Name, "Add Attr:", at.Name, at.Type, at.CtxFunc)
-										m.Attr = append(m.Attr, at)
-									}
-								}
-							}
-						}
-					}
-					f.mappers = append(f.mappers, m)
+			for _, spec := range t.Specs {
+				st, ok := spec.(*ast.TypeSpec)
+				if !ok {
+					continue
+				}
+				doc := t.Doc
+				if st.Doc != nil {
+					doc = st.Doc
 				}
+				api, text := parseDoc(doc)
+				ms := f.g.Spec[f.pkg.Path+"."+st.Name.String()]
+				if api == "" && ms == nil || f.external && ms == nil {
+					// 外部包仅解析注解文件中声明的模型
+					continue
+				}
+				m := f.genMapper(st, api, ms)
+				m.Doc = text
+				f.mappers = append(f.mappers, m)
 			}
 		}
 		return false
 	case *ast.FuncDecl:
-		if t.Doc != nil {
-			if strings.HasPrefix(t.Doc.Text(), "@tg") {
+		if !f.external {
+			if api, _ := parseDoc(t.Doc); api != "" {
+				f.g.addFunc(t.Name.String(), strings.TrimSpace(strings.TrimPrefix(api, "@tg")))
+			}
+		}
 
-				tgs := strings.Split(t.Doc.Text()[4:], " ")
-				for _, v := range tgs {
-					fc := Func{
-						Name: t.Name.String(),
-					}
-					v = strings.TrimSpace(v)
-					if strings.Index(v, ":") > -1 {
-						vs := strings.Split(v, ":")
-						vsv := strings.Split(vs[1], ",")
-
-						if strings.HasPrefix(v, "-") {
-							m := map[string]struct{}{}
-							for _, s := range vsv {
-								m[strings.TrimSpace(s)] = struct{}{}
-							}
-							fc.Excludes = m
-						} else {
-							m := map[string]int64{}
-							for _, s := range vsv {
-								if i := strings.LastIndex(s, "@"); i > -1 {
-									// 存在排序
-									vs := strings.Split(s, "@")
-									m[strings.TrimSpace(s[:i])], _ = strconv.ParseInt(vs[1], 10, 64)
-								} else {
-									m[strings.TrimSpace(s)] = -1
-								}
-							}
-							fc.Includes = m
-						}
-						v = strings.Trim(vs[0], "-")
-					} else {
-						if i := strings.LastIndex(v, "@"); i > -1 {
-							// 存在排序
-							vs := strings.Split(v, "@")
-							fc.Sort, _ = strconv.ParseInt(vs[1], 10, 64)
-							v = v[:i]
-						}
-					}
-					if fs, ok := f.g.Func[v]; ok {
-						fs = append(fs, fc)
-						f.g.Func[v] = fs
+		return false
+	}
+
+	return true
+}
+
+// genMapper 解析模型 ms为外部注解文件中的声明
+func (f *File) genMapper(st *ast.TypeSpec, api string, ms *ModelSpec) Mapper {
+	m := Mapper{
+		File: f,
+		Name: st.Name.String(),
+		API:  api,
+		Attr: []Attr{},
+	}
+	fspecs := map[string]map[string]string{}
+	if ms != nil {
+		m.API = mergeAPI(m.Name, api, ms.TG)
+		fspecs = ms.Fields
+	}
+	if f.external {
+		m.Import = f.pkg.Path
+	}
+	stf, ok := st.Type.(*ast.StructType)
+	if !ok {
+		return m
+	}
+	dbindexes := [][2]string{}  // 字段名 dbindex
+	columns := map[string]Key{} // 列名对应的字段
+	primaries := []string{}     // gorm:"primary_key" 的列
+	for _, field := range stf.Fields.List {
+		if field.Names == nil {
+			// 内嵌 gorm.Model 的主键为 ID
+			if se, ok := field.Type.(*ast.SelectorExpr); ok && se.Sel.Name == "Model" {
+				if x, ok := se.X.(*ast.Ident); ok && x.Name == "gorm" {
+					columns["id"] = Key{Name: "ID", GoType: "uint"}
+					columns["addtime"] = Key{Name: "CreatedAt", GoType: "int64"}
+					columns["uptime"] = Key{Name: "UpdatedAt", GoType: "int64"}
+					primaries = append(primaries, "id")
+					// nzlov/gorm 的 Model 软删除列为 deltime
+					m.DeletedAt = "deltime"
+				}
+			}
+			continue
+		}
+		at := Attr{}
+		at.Name = strings.TrimSpace(field.Names[0].Name)
+		doc, desc := parseFieldDoc(field)
+		columns[dbName(at.Name, field.Tag)] = Key{Name: at.Name, GoType: f.typeString(field.Type)}
+		if isPrimaryKey(field.Tag) {
+			primaries = append(primaries, dbName(at.Name, field.Tag))
+		}
+		if at.Name == "DeletedAt" {
+			// gorm 软删除
+			m.DeletedAt = dbName(at.Name, field.Tag)
+		}
+		if at.Name == "Version" && m.Version == "" {
+			// optimistic 未指定 version 字段时使用 Version
+			m.Version = at.Name
+			m.VersionColumn = dbName(at.Name, field.Tag)
+			m.VersionJSON = "version"
+		}
+		if field.Tag == nil && doc == nil && fspecs[at.Name] == nil {
+			logrus.Debugf("%s:%s not found tag", m.Name, at.Name)
+			continue
+		}
+		structTag := newFieldTag(m.Name, at.Name, field.Tag, doc, fspecs[at.Name])
+
+		if v, ok := structTag.Lookup("dbindex"); ok {
+			dbindexes = append(dbindexes, [2]string{at.Name, v})
+		}
+
+		if structTag.Get("group") == "true" || structTag.Get("agg") != "" {
+			// group:"true" 可以分组 agg:"sum,avg" 可以聚合的函数
+			a := AggField{
+				Name:   at.Name,
+				Column: dbName(at.Name, field.Tag),
+				JSON:   strings.Split(structTag.Get("json"), ",")[0],
+				GoType: f.typeString(field.Type),
+			}
+			if a.JSON == "" || a.JSON == "-" {
+				a.JSON = strings.ToLower(at.Name)
+			}
+			if structTag.Get("group") == "true" {
+				m.Groups = append(m.Groups, groupField(a))
+			}
+			if v := structTag.Get("agg"); v != "" {
+				m.Aggs = append(m.Aggs, aggField(m.Name, a, v))
+			}
+		}
+
+		if v, ok := structTag.Lookup("lookup"); ok {
+			// lookup:"slug,update,delete" 按唯一列查询 可选生成更新删除接口
+			m.Lookups = append(m.Lookups, parseLookup(m.Name, v, Key{
+				Name:   at.Name,
+				Column: dbName(at.Name, field.Tag),
+				GoType: f.typeString(field.Type),
+			}))
+		}
+
+		if structTag.Get("version") == "true" {
+			// 版本号由接口维护 不作为参数
+			m.Version = at.Name
+			m.VersionColumn = dbName(at.Name, field.Tag)
+			m.VersionJSON = strings.Split(structTag.Get("json"), ",")[0]
+			if m.VersionJSON == "" || m.VersionJSON == "-" {
+				m.VersionJSON = "version"
+			}
+			m.Optimistic = true
+			continue
+		}
+
+		at.Params = structTag.Get("params")
+		if at.Params == "" {
+			logrus.Debugf("%s:%s not found params", m.Name, at.Name)
+			continue
+		}
+
+		at.JSON = strings.Split(structTag.Get("json"), ",")[0]
+		if at.JSON == "" || at.JSON == "-" {
+			at.JSON = strings.ToLower(at.Name)
+		}
+		at.Enums = structTag.Get("enums")
+		at.MaxLength = structTag.Get("maxlength")
+		at.MinLength = structTag.Get("minlength")
+		at.Max = structTag.Get("max")
+		at.Min = structTag.Get("min")
+		at.Pattern = structTag.Get("pattern")
+		at.Format = structTag.Get("format")
+		at.TimeFormat = structTag.Get("timeformat")
+		at.TimeZone = structTag.Get("timezone")
+		at.Mime = structTag.Get("mime")
+		at.MaxSize = parseSize(m.Name, at.Name, structTag.Get("maxsize"))
+		at.Extra = parseExtraTag(structTag.Get("tg"))
+		at.GoType = f.typeString(field.Type)
+
+		if !f.paramType(&at, field.Type, structTag) {
+			logrus.Debugf("%s:%s param type not supported", m.Name, at.Name)
+			continue
+		}
+		at.File = at.Type == "file"
+		if at.NullKind == "" && at.CtxFunc != "@" && strings.HasPrefix(at.GoType, "*") {
+			// 指针字段 请求参数使用指向的类型 可以为 null
+			at.NullKind = "ptr"
+			at.ReqType = at.GoType[1:]
+		}
+		if at.ReqType == "" {
+			at.ReqType = at.GoType
+		}
+		at.Null = at.NullKind != "" && structTag.Get("null") == "true"
+		if desc != "" {
+			at.Desc = desc
+		} else {
+			at.Desc = strings.TrimSpace(at.Name)
+		}
+		logrus.Debugln(m.Name, "Add Attr:", at.Name, at.Type, at.CtxFunc, at.Encoding)
+		m.Attr = append(m.Attr, at)
+	}
+	if len(dbindexes) == 0 {
+		// 没有 dbindex 时使用 gorm 的主键 primary_key 内嵌 gorm.Model 或 ID 字段
+		if len(primaries) > 0 {
+			dbindexes = append(dbindexes, [2]string{"", strings.Join(primaries, ",")})
+		} else {
+			for c, k := range columns {
+				if k.Name == "ID" {
+					dbindexes = append(dbindexes, [2]string{"", c})
+				}
+			}
+		}
+		if len(dbindexes) > 0 {
+			logrus.Debugf("%s: use primary key %s", m.Name, dbindexes[0][1])
+		}
+	}
+	m.Keys = genKeys(m.Name, dbindexes, columns)
+	m.Columns = columns
+	if len(m.Keys) > 0 {
+		m.DBIndex = m.Keys[0].Column
+	}
+	return m
+}
+
+// genKeys 解析主键
+// 复合主键在其中一个字段上声明全部列 dbindex:"tenant_id,code", 其他字段的 dbindex 需要包含在其中
+func genKeys(name string, dbindexes [][2]string, columns map[string]Key) []Key {
+	if len(dbindexes) == 0 {
+		return nil
+	}
+	full := splitColumns(dbindexes[0][1])
+	for _, v := range dbindexes[1:] {
+		if cs := splitColumns(v[1]); len(cs) > len(full) {
+			full = cs
+		}
+	}
+	fulls := strings.Join(full, ",")
+	// 单列的 dbindex 指定列对应的字段
+	fields := map[string]string{}
+	for _, v := range dbindexes {
+		cs := splitColumns(v[1])
+		if len(cs) == 0 {
+			logrus.Fatalf("%s: empty dbindex on %s", name, v[0])
+		}
+		if len(cs) > 1 {
+			if strings.Join(cs, ",") != fulls {
+				logrus.Fatalf("%s: conflicting dbindex %q and %q", name, v[1], fulls)
+			}
+			continue
+		}
+		if !contains(full, cs[0]) {
+			logrus.Fatalf("%s: conflicting dbindex %q on %s and %q, declare the composite key as dbindex:\"a,b\"", name, v[1], v[0], fulls)
+		}
+		if f, ok := fields[cs[0]]; ok && f != v[0] {
+			logrus.Fatalf("%s: dbindex %q declared on both %s and %s", name, cs[0], f, v[0])
+		}
+		fields[cs[0]] = v[0]
+	}
+	keys := []Key{}
+	for _, c := range full {
+		k, ok := columns[c]
+		if f, has := fields[c]; has {
+			for _, v := range columns {
+				if v.Name == f {
+					k, ok = v, true
+				}
+			}
+		}
+		if !ok {
+			logrus.Fatalf("%s: dbindex column %q does not match any field", name, c)
+		}
+		k.Column = c
+		k.Param = c
+		k.Type = keyType(k.GoType)
+		keys = append(keys, k)
+	}
+	if len(keys) == 1 {
+		// 单列主键的路径参数保持为 id
+		keys[0].Param = "id"
+	}
+	return keys
+}
+
+// keyType 路径参数的 swagger 类型 integer string
+func keyType(goType string) string {
+	if st, ok := scalarTypes[strings.TrimPrefix(goType, "u")]; ok && st[0] == "integer" {
+		return "integer"
+	}
+	return "string"
+}
+
+// parseLookup 解析 lookup:"name,update,delete" name 为空时使用列名
+func parseLookup(model, s string, k Key) Lookup {
+	vs := strings.Split(s, ",")
+	k.Param = strings.TrimSpace(vs[0])
+	if k.Param == "" {
+		k.Param = k.Column
+	}
+	k.Type = keyType(k.GoType)
+	if strings.HasPrefix(k.GoType, "*") || strings.HasPrefix(k.GoType, "sql.Null") {
+		logrus.Fatalf("%s: lookup field %s can not be nullable", model, k.Name)
+	}
+	l := Lookup{Key: k}
+	for _, v := range vs[1:] {
+		switch strings.TrimSpace(v) {
+		case "update":
+			l.Update = true
+		case "delete":
+			l.Delete = true
+		default:
+			logrus.Warnf("%s: unknown lookup option %q on %s", model, v, k.Name)
+		}
+	}
+	return l
+}
+
+// aggFuncs 支持的聚合函数 agg:"true" 时全部可用
+var aggFuncs = []string{"sum", "avg", "min", "max"}
+
+// groupField 分组结果使用指针 列可以为 null
+func groupField(a AggField) AggField {
+	if strings.HasPrefix(a.GoType, "sql.") {
+		a.GoType = "*" + sqlNullTypes[a.GoType[len("sql."):]][1]
+	} else if !strings.HasPrefix(a.GoType, "*") {
+		a.GoType = "*" + a.GoType
+	}
+	return a
+}
+
+// aggField 解析 agg:"sum,avg" 只支持数值字段
+func aggField(model string, a AggField, s string) AggField {
+	t := strings.TrimPrefix(a.GoType, "*")
+	st, ok := scalarTypes[strings.TrimPrefix(t, "u")]
+	if nt, isNull := sqlNullTypes[strings.TrimPrefix(t, "sql.")]; isNull {
+		st, ok = [2]string{nt[2], nt[3]}, true
+	}
+	if !ok || (st[0] != "integer" && st[0] != "number") {
+		logrus.Fatalf("%s: agg field %s must be a number", model, a.Name)
+	}
+	fs := strings.Split(s, ",")
+	if s == "true" {
+		fs = aggFuncs
+	}
+	for _, f := range fs {
+		f = strings.TrimSpace(f)
+		if !contains(aggFuncs, f) {
+			logrus.Warnf("%s: unknown agg %q on %s", model, f, a.Name)
+			continue
+		}
+		a.Funcs = append(a.Funcs, AggFunc{
+			Key:   f + ":" + a.JSON,
+			Func:  strings.ToUpper(f),
+			Field: strings.ToUpper(f[:1]) + f[1:] + a.Name,
+			Alias: f + "_" + a.Column,
+			JSON:  f + "_" + a.JSON,
+		})
+	}
+	return a
+}
+
+// splitColumns 逗号分隔的列名
+func splitColumns(s string) []string {
+	cs := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			cs = append(cs, v)
+		}
+	}
+	return cs
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// dbName 字段对应的列名 gorm:"column:x" 或 gorm 默认的蛇形命名
+func dbName(name string, tag *ast.BasicLit) string {
+	if v, ok := gormTag(tag)["COLUMN"]; ok && v != "" {
+		return v
+	}
+	return gorm.ToDBName(name)
+}
+
+// gormTag 解析 gorm 标签 key 为大写 gorm:"column:id;primary_key"
+func gormTag(tag *ast.BasicLit) map[string]string {
+	m := map[string]string{}
+	if tag == nil {
+		return m
+	}
+	gt := reflect.StructTag(strings.Trim(tag.Value, "`")).Get("gorm")
+	for _, v := range strings.Split(gt, ";") {
+		vs := strings.SplitN(strings.TrimSpace(v), ":", 2)
+		if vs[0] == "" {
+			continue
+		}
+		m[strings.ToUpper(vs[0])] = strings.Join(vs[1:], "")
+	}
+	return m
+}
+
+// isPrimaryKey gorm:"primary_key" 或 gorm:"primaryKey"
+func isPrimaryKey(tag *ast.BasicLit) bool {
+	gt := gormTag(tag)
+	_, ok := gt["PRIMARY_KEY"]
+	_, ok2 := gt["PRIMARYKEY"]
+	return ok || ok2
+}
+
+// isTg 是否为 @tg 注解 排除 @tg-default
+func isTg(s string) bool {
+	return strings.HasPrefix(s, "@tg") && (len(s) == 3 || s[3] == ' ' || s[3] == '\n')
+}
+
+// typeString 字段类型在生成代码中的写法 模型包中的类型加上包名
+func (f *File) typeString(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if types.Universe.Lookup(t.Name) != nil {
+			return t.Name
+		}
+		if f.external {
+			return "ext." + t.Name
+		}
+		return "models." + t.Name
+	case *ast.StarExpr:
+		return "*" + f.typeString(t.X)
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return "[]" + f.typeString(t.Elt)
+		}
+		return "[" + types.ExprString(t.Len) + "]" + f.typeString(t.Elt)
+	case *ast.MapType:
+		return "map[" + f.typeString(t.Key) + "]" + f.typeString(t.Value)
+	}
+	return types.ExprString(expr)
+}
+
+// scalarTypes 基础类型对应的 swagger 类型与读取方法
+var scalarTypes = map[string][2]string{
+	"bool":    {"bool", "Bool"},
+	"int":     {"integer", "Int64"},
+	"int8":    {"integer", "Int64"},
+	"int16":   {"integer", "Int64"},
+	"int32":   {"integer", "Int64"},
+	"int64":   {"integer", "Int64"},
+	"float32": {"number", "Float64"},
+	"float64": {"number", "Float64"},
+}
+
+// sqlNullTypes sql.NullX 的值字段 值类型 swagger 类型 读取方法
+var sqlNullTypes = map[string][4]string{
+	"NullString":  {"String", "string", "string", "String"},
+	"NullInt64":   {"Int64", "int64", "integer", "Int64"},
+	"NullInt32":   {"Int32", "int32", "integer", "Int64"},
+	"NullFloat64": {"Float64", "float64", "number", "Float64"},
+	"NullBool":    {"Bool", "bool", "bool", "Bool"},
+	"NullTime":    {"Time", "time.Time", "string", ""},
+}
+
+// paramType 根据字段类型确定参数类型与读取方式 返回false表示不支持
+func (f *File) paramType(at *Attr, expr ast.Expr, tag fieldTag) bool {
+	ident, isIdent := expr.(*ast.Ident)
+	if v, ok := tag.Lookup("pt"); ok {
+		vs := strings.Split(v, ":")
+		if !isIdent && len(vs) != 2 {
+			logrus.Debugf("%s param type error:%s", at.Name, v)
+			return false
+		}
+		at.Type = vs[0]
+		at.CtxFunc = "String"
+		if isIdent {
+			if st, ok := f.scalarType(ident); ok {
+				at.CtxFunc = st[1]
+			}
+		}
+		if len(vs) > 1 {
+			if strings.HasPrefix(vs[1], "@") {
+				at.CtxFunc = "@"
+				at.IToM = vs[1][1:]
+			} else {
+				at.CtxFunc = vs[1]
+			}
+		}
+		return true
+	}
+
+	json := func() bool {
+		at.Type = "string"
+		at.Encoding = "json"
+		return true
+	}
+	if at.Format == "json" {
+		return json()
+	}
+	if isTime(expr) {
+		at.Type = "string"
+		if at.TimeFormat == "unix" || at.TimeFormat == "unixmilli" {
+			at.Type = "integer"
+		}
+		at.Encoding = "time"
+		return true
+	}
+
+	switch t := expr.(type) {
+	case *ast.Ident:
+		st, ok := f.scalarType(t)
+		if !ok {
+			// 命名的结构体 切片 map 等使用 json
+			return json()
+		}
+		at.Type = st[0]
+		at.CtxFunc = st[1]
+		return true
+	case *ast.ArrayType:
+		if e, ok := t.Elt.(*ast.Ident); ok && t.Len == nil && e.Name != "byte" {
+			st, ok := f.scalarType(e)
+			if !ok {
+				return json()
+			}
+			// 基础类型切片 默认重复的key 也可以 format:"csv"
+			at.Type = "[]" + st[0]
+			at.Encoding = "multi"
+			if at.Format == "csv" {
+				at.Encoding = "csv"
+			}
+			return true
+		}
+		return json()
+	case *ast.MapType, *ast.StructType:
+		return json()
+	case *ast.StarExpr:
+		if i, ok := t.X.(*ast.Ident); ok {
+			if st, ok := f.scalarType(i); ok {
+				// 可为空的基础类型 *string
+				at.Type = st[0]
+				at.CtxFunc = st[1]
+				return true
+			}
+		}
+		return json()
+	case *ast.SelectorExpr:
+		if x, ok := t.X.(*ast.Ident); ok && x.Name == "sql" {
+			if nt, ok := sqlNullTypes[t.Sel.Name]; ok {
+				at.NullKind = "sql"
+				at.NullField = nt[0]
+				at.ReqType = nt[1]
+				at.Type = nt[2]
+				at.CtxFunc = nt[3]
+				if at.NullField == "Time" {
+					at.Encoding = "time"
+				}
+				return true
+			}
+		}
+		// postgres.Jsonb 之类的 json 列
+		if strings.HasPrefix(t.Sel.Name, "Json") {
+			return json()
+		}
+	}
+	return false
+}
+
+// scalarType 基础类型及底层为基础类型的命名类型 返回 swagger 类型与读取方法
+func (f *File) scalarType(ident *ast.Ident) ([2]string, bool) {
+	name := ident.Name
+	if types.Universe.Lookup(name) == nil {
+		// 命名类型 使用类型信息解析底层类型
+		tv, ok := f.pkg.types[ident]
+		if !ok || tv.Type == nil {
+			return [2]string{}, false
+		}
+		b, ok := tv.Type.Underlying().(*types.Basic)
+		if !ok {
+			return [2]string{}, false
+		}
+		name = b.Name()
+	}
+	if st, ok := scalarTypes[name]; ok {
+		return st, true
+	}
+	if name == "string" {
+		return [2]string{"string", "String"}, true
+	}
+	return [2]string{}, false
+}
+
+// isTime 是否为 time.Time 或 *time.Time
+func isTime(expr ast.Expr) bool {
+	if t, ok := expr.(*ast.StarExpr); ok {
+		expr = t.X
+	}
+	t, ok := expr.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	x, ok := t.X.(*ast.Ident)
+	return ok && x.Name == "time" && t.Sel.Name == "Time"
+}
+
+// parseSize 解析文件大小 10MB 512KB 1024 返回字节数
+func parseSize(model, name, s string) string {
+	if s == "" {
+		return ""
+	}
+	n := strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range []struct {
+		s string
+		n int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(n, u.s) {
+			n = strings.TrimSpace(strings.TrimSuffix(n, u.s))
+			unit = u.n
+			break
+		}
+	}
+	v, err := strconv.ParseInt(n, 10, 64)
+	if err != nil {
+		logrus.Warnf("%s:%s maxsize error:%s", model, name, s)
+		return ""
+	}
+	return strconv.FormatInt(v*unit, 10)
+}
+
+// parseDoc 解析注释 所有 @tg 行按顺序合并 其余非空行作为说明
+func parseDoc(doc *ast.CommentGroup) (string, []string) {
+	if doc == nil {
+		return "", nil
+	}
+	found := false
+	ops := []string{}
+	text := []string{}
+	for _, l := range strings.Split(doc.Text(), "\n") {
+		l = strings.TrimSpace(l)
+		if isTg(l) {
+			found = true
+			if o := strings.TrimSpace(l[3:]); o != "" {
+				ops = append(ops, o)
+			}
+			continue
+		}
+		if l != "" {
+			text = append(text, l)
+		}
+	}
+	if !found {
+		return "", text
+	}
+	return strings.TrimSpace("@tg " + strings.Join(ops, " ")), text
+}
+
+// parseDefault 解析包默认注解 security=AppUser;nosave 不含:的选项可以用;分隔
+func parseDefault(s string) []string {
+	ds := []string{}
+	for _, v := range strings.Fields(s) {
+		if strings.Index(v, ":") > -1 {
+			ds = append(ds, v)
+			continue
+		}
+		for _, vv := range strings.Split(v, ";") {
+			if vv != "" {
+				ds = append(ds, vv)
+			}
+		}
+	}
+	return ds
+}
+
+// addFunc 注册方法 api为 @tg 之后的内容
+func (g *Generator) addFunc(name, api string) {
+	tgs := strings.Split(api, " ")
+	for _, v := range tgs {
+		fc := Func{
+			Name: name,
+		}
+		v = strings.TrimSpace(v)
+		if v == "" {
+			// 只有 @tg 的注释
+			continue
+		}
+		if strings.Index(v, ":") > -1 {
+			vs := strings.Split(v, ":")
+			vsv := strings.Split(vs[1], ",")
+
+			if strings.HasPrefix(v, "-") {
+				m := map[string]struct{}{}
+				for _, s := range vsv {
+					m[strings.TrimSpace(s)] = struct{}{}
+				}
+				fc.Excludes = m
+			} else {
+				m := map[string]int64{}
+				for _, s := range vsv {
+					if i := strings.LastIndex(s, "@"); i > -1 {
+						// 存在排序
+						vs := strings.Split(s, "@")
+						m[strings.TrimSpace(s[:i])], _ = strconv.ParseInt(vs[1], 10, 64)
 					} else {
-						f.g.Func[v] = []Func{fc}
+						m[strings.TrimSpace(s)] = -1
 					}
 				}
+				fc.Includes = m
+			}
+			v = strings.Trim(vs[0], "-")
+		} else {
+			if i := strings.LastIndex(v, "@"); i > -1 {
+				// 存在排序
+				vs := strings.Split(v, "@")
+				fc.Sort, _ = strconv.ParseInt(vs[1], 10, 64)
+				v = v[:i]
 			}
 		}
+		if fs, ok := g.Func[v]; ok {
+			dup := false
+			for _, f := range fs {
+				if f.Name == name {
+					logrus.Warnf("conflict: %s already registered on %s, ignore %s", name, v, strings.TrimSpace(api))
+					dup = true
+				}
+			}
+			if !dup {
+				g.Func[v] = append(fs, fc)
+			}
+		} else {
+			g.Func[v] = []Func{fc}
+		}
+	}
+}
 
-		return false
+// parseFieldDoc 解析字段注释 // @tg params=CU enums=a,b,c max=10
+// 返回注解与说明 注解语义与 struct tag 相同 x- 开头的选项合并到 tg
+func parseFieldDoc(field *ast.Field) (map[string]string, string) {
+	var doc map[string]string
+	_, text := parseDoc(field.Doc)
+	// 行尾注释只解析注解
+	for _, cg := range []*ast.CommentGroup{field.Doc, field.Comment} {
+		api, _ := parseDoc(cg)
+		if api == "" {
+			continue
+		}
+		if doc == nil {
+			doc = map[string]string{}
+		}
+		for _, v := range strings.Fields(api[3:]) {
+			if isExtra(v) {
+				doc["tg"] = strings.TrimSpace(doc["tg"] + " " + v)
+				continue
+			}
+			vs := strings.SplitN(v, "=", 2)
+			doc[vs[0]] = strings.Join(vs[1:], "")
+		}
 	}
+	return doc, strings.Join(text, " ")
+}
 
-	return true
+// fieldTag 字段注解 合并 struct tag, 字段注释与外部注解文件 优先级依次降低
+type fieldTag struct {
+	tag  reflect.StructTag
+	doc  map[string]string
+	spec map[string]string
+}
+
+func newFieldTag(model, name string, tag *ast.BasicLit, doc, spec map[string]string) fieldTag {
+	ft := fieldTag{doc: doc, spec: spec}
+	if tag != nil {
+		ft.tag = reflect.StructTag(strings.Replace(tag.Value, "`", "", -1))
+	}
+	for k, v := range doc {
+		if tv, ok := ft.tag.Lookup(k); ok && tv != v {
+			logrus.Warnf("conflict: %s.%s %s=%q in tag, %q in comment, use tag", model, name, k, tv, v)
+		}
+	}
+	for k, v := range spec {
+		if tv, ok := ft.tag.Lookup(k); ok && tv != v {
+			logrus.Warnf("conflict: %s.%s %s=%q in tag, %q in spec, use tag", model, name, k, tv, v)
+		} else if dv, ok := doc[k]; ok && dv != v {
+			logrus.Warnf("conflict: %s.%s %s=%q in comment, %q in spec, use comment", model, name, k, dv, v)
+		}
+	}
+	return ft
+}
+
+func (t fieldTag) Lookup(k string) (string, bool) {
+	if v, ok := t.tag.Lookup(k); ok {
+		return v, ok
+	}
+	if v, ok := t.doc[k]; ok {
+		return v, ok
+	}
+	v, ok := t.spec[k]
+	return v, ok
+}
+
+func (t fieldTag) Get(k string) string {
+	v, _ := t.Lookup(k)
+	return v
+}
+
+// parseExtraTag 解析字段 tg 标签中的自定义注解 tg:"x-a=1 x-b"
+func parseExtraTag(tag string) Extra {
+	e := Extra{}
+	for _, v := range strings.Fields(tag) {
+		if !isExtra(v) {
+			logrus.Warnf("unknown tg tag option: %s", v)
+			continue
+		}
+		e.Set(v)
+	}
+	return e
 }
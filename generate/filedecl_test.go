@@ -0,0 +1,55 @@
+package generate
+
+import (
+	"go/ast"
+	"testing"
+)
+
+func TestGenDeclFunc(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		funcs map[string]int
+	}{
+		{"bare", []string{"// CheckUser 校验", "// @tg"}, map[string]int{}},
+		{"ops", []string{"// @tg CreateBefore:User@10", "// @tg UpdateAfter:User,Item"}, map[string]int{"CreateBefore": 1, "UpdateAfter": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := &ast.CommentGroup{}
+			for _, l := range tt.lines {
+				doc.List = append(doc.List, &ast.Comment{Text: l})
+			}
+			g := &Generator{Func: map[string][]Func{}}
+			f := &File{g: g}
+			f.genDecl(&ast.FuncDecl{Name: ast.NewIdent("CheckUser"), Doc: doc})
+			if len(g.Func) != len(tt.funcs) {
+				t.Fatalf("want %v got %v", tt.funcs, g.Func)
+			}
+			for k, n := range tt.funcs {
+				if len(g.Func[k]) != n {
+					t.Fatalf("%s: want %d got %v", k, n, g.Func[k])
+				}
+			}
+		})
+	}
+}
+
+func TestDBName(t *testing.T) {
+	tag := func(s string) *ast.BasicLit { return &ast.BasicLit{Value: s} }
+	tests := []struct {
+		name string
+		tag  *ast.BasicLit
+		want string
+	}{
+		{"UserID", nil, "user_id"},
+		{"ExternalIDs", nil, "external_ids"},
+		{"HTTPCode", nil, "http_code"},
+		{"Name", tag("`gorm:\"column:nick\"`"), "nick"},
+	}
+	for _, tt := range tests {
+		if got := dbName(tt.name, tt.tag); got != tt.want {
+			t.Fatalf("%s: want %s got %s", tt.name, tt.want, got)
+		}
+	}
+}
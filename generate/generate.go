@@ -41,6 +41,7 @@ func (g *Generator) AddPackage(pkg *packages.Package) {
 		Name:  pkg.Name,
 		Path:  pkg.PkgPath,
 		defs:  pkg.TypesInfo.Defs,
+		types: pkg.TypesInfo.Types,
 		files: make([]*File, len(pkg.Syntax)),
 	}
 	g.Project = strings.Join(strings.Split(pkg.PkgPath, "/")[:3], "/")
@@ -48,6 +49,7 @@ func (g *Generator) AddPackage(pkg *packages.Package) {
 	for i, file := range pkg.Syntax {
 		g.Pkg.files[i] = &File{
 			g:           g,
+			name:        filepath.Base(pkg.Fset.File(file.Pos()).Name()),
 			file:        file,
 			imp:         make([]string, 0),
 			pkg:         g.Pkg,
@@ -68,8 +70,14 @@ func (g *Generator) Generate() {
 		cT = t
 	}
 
+	files := g.Pkg.files
+	for _, p := range g.Ext {
+		files = append(files, p.files...)
+	}
+
+	g.Pkg.Default = nil
 	mappers := make([]Mapper, 0, 100)
-	for _, file := range g.Pkg.files {
+	for _, file := range files {
 		file.mappers = nil
 		if file.file != nil {
 			ast.Inspect(file.file, file.genDecl)
@@ -82,6 +90,32 @@ func (g *Generator) Generate() {
 		}
 	}
 
+	for _, fs := range g.SpecFunc {
+		g.addFunc(fs.Name, fs.TG)
+	}
+
+	for k, ms := range g.Spec {
+		found := false
+		for _, m := range mappers {
+			if m.File.pkg.Path == ms.Package && m.Name == ms.Name {
+				found = true
+			}
+		}
+		if !found {
+			logrus.Fatalf("spec: %s not found", k)
+		}
+	}
+
+	// 不同包中的同名模型会输出到同一个目录
+	outputs := map[string]Mapper{}
+	for _, m := range mappers {
+		name := strings.ToLower(m.Name) + "s"
+		if o, ok := outputs[name]; ok {
+			logrus.Fatalf("output conflict: %s.%s and %s.%s both generate %s", o.File.pkg.Path, o.Name, m.File.pkg.Path, m.Name, filepath.Join(g.Output, name))
+		}
+		outputs[name] = m
+	}
+
 	if len(mappers) < g.gonum {
 		g.gonum = int(math.Log(float64(g.gonum)))
 	}
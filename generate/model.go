@@ -5,8 +5,13 @@ import (
 	"go/ast"
 	"go/types"
 	"os"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+
+	"github.com/nzlov/tg/bind"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -26,6 +31,17 @@ const (
 	FuncType_DeleteTxBefore = "DeleteTxBefore"
 	FuncType_DeleteTxAfter  = "DeleteTxAfter"
 	FuncType_DeleteAfter    = "DeleteAfter"
+
+	FuncType_TrashBefore     = "TrashBefore"
+	FuncType_TrashAfter      = "TrashAfter"
+	FuncType_RestoreBefore   = "RestoreBefore"
+	FuncType_RestoreTxBefore = "RestoreTxBefore"
+	FuncType_RestoreTxAfter  = "RestoreTxAfter"
+	FuncType_RestoreAfter    = "RestoreAfter"
+	FuncType_PurgeBefore     = "PurgeBefore"
+	FuncType_PurgeTxBefore   = "PurgeTxBefore"
+	FuncType_PurgeTxAfter    = "PurgeTxAfter"
+	FuncType_PurgeAfter      = "PurgeAfter"
 )
 
 type Generator struct {
@@ -41,6 +57,10 @@ type Generator struct {
 	Template    string
 
 	Func map[string][]Func // 所有的ModelController都需要的方法
+
+	Spec     map[string]*ModelSpec // 外部注解文件声明的模型 key为 包路径.类型名
+	Ext      []*Package            // 外部注解文件引用的其他包
+	SpecFunc []FuncSpec            // 外部注解文件注册的方法
 }
 
 func NewGenerator(gonum int, trimprefix, output string, linecomment, debug bool, template string) *Generator {
@@ -53,6 +73,7 @@ func NewGenerator(gonum int, trimprefix, output string, linecomment, debug bool,
 		Template:    template,
 
 		Func: map[string][]Func{},
+		Spec: map[string]*ModelSpec{},
 	}
 }
 
@@ -63,10 +84,32 @@ type Mapper struct {
 	Attr    []Attr
 	DBIndex string
 	API     string
+	Import  string   // 模型不在当前包时的包路径
+	Doc     []string // 注释中 @tg 以外的内容
+
+	Keys          []Key  // 主键 复合主键时有多个
+	DeletedAt     string // 软删除列 DeletedAt 字段或内嵌 gorm.Model
+	Version       string // 版本号字段 version:"true" 或 Version
+	VersionColumn string
+	VersionJSON   string
+	Optimistic    bool // 存在 version:"true" 的字段
+
+	Columns map[string]Key // 列名对应的字段
+	Lookups []Lookup       // lookup:"slug" 按唯一列查询
+	Groups  []AggField     // group:"true" 可以分组的字段
+	Aggs    []AggField     // agg:"sum,avg" 可以聚合的字段
 }
 
 func (m Mapper) Render() Render {
 
+	desc := m.Name
+	description := m.Doc
+	if len(m.Doc) > 0 && !strings.HasPrefix(m.Doc[0], m.Name+" ") {
+		// 注释第一行作为名称 其余作为详细说明 以类型名开头的 godoc 注释全部作为说明
+		desc = m.Doc[0]
+		description = m.Doc[1:]
+	}
+
 	r := Render{
 		Args:        strings.Join(os.Args[1:], " "),
 		PackageName: strings.ToLower(m.Name) + "s",
@@ -74,8 +117,28 @@ func (m Mapper) Render() Render {
 		Name:        m.Name,
 		DBIndex:     m.DBIndex,
 		CreateSave:  true,
+		ListTotal:   true,
+		CreateForm:  true,
 		UpdateSave:  true,
-		Desc:        m.Name,
+		UpdateForm:  true,
+		Desc:        desc,
+		Tag:         m.Name,
+		Description: description,
+		Model:       "models." + m.Name,
+		ModelImport: m.Import,
+		Extra:       Extra{},
+		OpExtra:     map[string]Extra{},
+
+		BatchMax:        1000,
+		BatchUpdateMax:  1000,
+		DeleteFilterMax: 100,
+		UpdateFilterMax: 100,
+		AggregateMax:    1000,
+
+		Optimistic:    m.Optimistic,
+		Version:       m.Version,
+		VersionColumn: m.VersionColumn,
+		VersionJSON:   m.VersionJSON,
 	}
 
 	for k, v := range m.File.g.Func {
@@ -121,13 +184,40 @@ func (m Mapper) Render() Render {
 			r.DeleteTxAfter = mfs
 		case FuncType_DeleteAfter:
 			r.DeleteAfter = mfs
+		case FuncType_TrashBefore:
+			r.TrashBefore = mfs
+		case FuncType_TrashAfter:
+			r.TrashAfter = mfs
+		case FuncType_RestoreBefore:
+			r.RestoreBefore = mfs
+		case FuncType_RestoreTxBefore:
+			r.RestoreTxBefore = mfs
+		case FuncType_RestoreTxAfter:
+			r.RestoreTxAfter = mfs
+		case FuncType_RestoreAfter:
+			r.RestoreAfter = mfs
+		case FuncType_PurgeBefore:
+			r.PurgeBefore = mfs
+		case FuncType_PurgeTxBefore:
+			r.PurgeTxBefore = mfs
+		case FuncType_PurgeTxAfter:
+			r.PurgeTxAfter = mfs
+		case FuncType_PurgeAfter:
+			r.PurgeAfter = mfs
 
 		}
 
 	}
 
+	upsertKey := ""
+	listSort := ""
+	security := map[string]bool{} // 单独设置了 security 的接口
 	{
 		v := strings.Split(m.API, " ")
+		if d := m.File.g.Pkg.Default; len(d) > 0 {
+			// 包默认注解在模型注解之前执行 可以被覆盖或通过 -key 移除 外部注解文件声明的模型同样使用
+			v = append(append([]string{v[0]}, d...), v[1:]...)
+		}
 		if len(v) == 1 {
 			r.Create = true
 			r.Update = true
@@ -143,6 +233,11 @@ func (m Mapper) Render() Render {
 
 			for _, vv := range v {
 
+				if isExtra(vv) {
+					r.Extra.Set(vv)
+					continue
+				}
+
 				if vv == "nosave" {
 					r.CreateSave = false
 					r.UpdateSave = false
@@ -151,6 +246,7 @@ func (m Mapper) Render() Render {
 					vs := strings.Split(vv, "=")
 					if len(vs) > 1 {
 						r.Desc = vs[1]
+						r.Tag = vs[1]
 					}
 				}
 
@@ -171,7 +267,52 @@ func (m Mapper) Render() Render {
 					r.ListSecurity = sec
 					r.InfoSecurity = sec
 					r.DeleteSecurity = sec
+					r.TrashSecurity = sec
+					r.RestoreSecurity = sec
+					r.PurgeSecurity = sec
+					r.BatchSecurity = sec
+					r.BatchUpdateSecurity = sec
+					r.UpsertSecurity = sec
+					r.DeleteFilterSecurity = sec
+					r.UpdateFilterSecurity = sec
+
+				}
 
+				if vv == "optimistic" {
+					r.Optimistic = true
+				}
+
+				// 回收站接口需要显式开启 trash 开启全部
+				switch vv {
+				case "trash":
+					r.Trash, r.Restore, r.Purge = true, true, true
+				case "Trash":
+					r.Trash = true
+				case "Restore":
+					r.Restore = true
+				case "Purge":
+					r.Purge = true
+				case "batch":
+					r.Batch, r.BatchUpdate = true, true
+				case "Batch":
+					r.Batch = true
+				case "BatchUpdate":
+					r.BatchUpdate = true
+				case "Upsert":
+					r.Upsert = true
+				case "DeleteFilter":
+					r.DeleteFilter = true
+				case "UpdateFilter":
+					r.UpdateFilter = true
+				case "Count":
+					r.Count = true
+				case "Aggregate":
+					r.Aggregate = true
+				}
+
+				if strings.HasPrefix(vv, "accept=") {
+					r.CreateJSON, r.CreateForm = parseAccept(vv[len("accept="):])
+					r.UpdateJSON, r.UpdateForm = r.CreateJSON, r.CreateForm
 				}
 
 				if strings.HasPrefix(vv, "-") {
@@ -186,6 +327,174 @@ func (m Mapper) Render() Render {
 						r.Info = false
 					case "-Delete":
 						r.Delete = false
+					case "-trash":
+						r.Trash, r.Restore, r.Purge = false, false, false
+					case "-Trash":
+						r.Trash = false
+					case "-Restore":
+						r.Restore = false
+					case "-Purge":
+						r.Purge = false
+					case "-batch":
+						r.Batch, r.BatchUpdate = false, false
+					case "-Batch":
+						r.Batch = false
+					case "-BatchUpdate":
+						r.BatchUpdate = false
+					case "-Upsert":
+						r.Upsert = false
+					case "-DeleteFilter":
+						r.DeleteFilter = false
+					case "-UpdateFilter":
+						r.UpdateFilter = false
+					case "-Count":
+						r.Count = false
+					case "-Aggregate":
+						r.Aggregate = false
+					case "-nosave":
+						r.CreateSave = true
+						r.UpdateSave = true
+					case "-desc":
+						r.Desc = desc
+						r.Tag = m.Name
+					case "-preload":
+						r.InfoPreload = false
+						r.InfoPreloadV = nil
+						r.ListPreload = false
+						r.ListPreloadV = nil
+					case "-security":
+						r.CreateSecurity = nil
+						r.UpdateSecurity = nil
+						r.ListSecurity = nil
+						r.InfoSecurity = nil
+						r.DeleteSecurity = nil
+						r.TrashSecurity = nil
+						r.RestoreSecurity = nil
+						r.PurgeSecurity = nil
+						r.BatchSecurity = nil
+						r.BatchUpdateSecurity = nil
+						r.UpsertSecurity = nil
+						r.DeleteFilterSecurity = nil
+						r.UpdateFilterSecurity = nil
+					case "-accept":
+						r.CreateJSON, r.CreateForm = false, true
+						r.UpdateJSON, r.UpdateForm = false, true
+					case "-optimistic":
+						r.Optimistic = false
+					default:
+						if isExtra(vv[1:]) {
+							delete(r.Extra, vv[1:])
+							break
+						}
+						// -Create:security 移除单个接口的选项
+						vvs := strings.Split(vv[1:], ":")
+						if len(vvs) != 2 {
+							break
+						}
+						if isExtra(vvs[1]) {
+							delete(r.OpExtra[vvs[0]], vvs[1])
+							break
+						}
+						switch vvs[1] {
+						case "nosave":
+							switch vvs[0] {
+							case "Create":
+								r.CreateSave = true
+							case "Update":
+								r.UpdateSave = true
+							}
+						case "preload":
+							switch vvs[0] {
+							case "Info":
+								r.InfoPreload = false
+								r.InfoPreloadV = nil
+							case "List":
+								r.ListPreload = false
+								r.ListPreloadV = nil
+							}
+						case "mode":
+							switch vvs[0] {
+							case "Update":
+								r.UpdatePatch = false
+							case "Batch":
+								r.BatchPartial = false
+							case "BatchUpdate":
+								r.BatchUpdatePartial = false
+							}
+						case "max":
+							switch vvs[0] {
+							case "Batch":
+								r.BatchMax = 1000
+							case "BatchUpdate":
+								r.BatchUpdateMax = 1000
+							case "DeleteFilter":
+								r.DeleteFilterMax = 100
+							case "UpdateFilter":
+								r.UpdateFilterMax = 100
+							case "Aggregate":
+								r.AggregateMax = 1000
+							}
+						case "optimistic":
+							if vvs[0] == "Update" {
+								r.Optimistic = false
+							}
+						case "paging":
+							if vvs[0] == "List" {
+								r.ListCursor = false
+							}
+						case "sort":
+							if vvs[0] == "List" {
+								listSort = ""
+							}
+						case "nototal":
+							if vvs[0] == "List" {
+								r.ListTotal = true
+							}
+						case "lock":
+							switch vvs[0] {
+							case "Update":
+								r.UpdateLock = ""
+							case "Delete":
+								r.DeleteLock = ""
+							}
+						case "accept":
+							switch vvs[0] {
+							case "Create":
+								r.CreateJSON, r.CreateForm = false, true
+							case "Update":
+								r.UpdateJSON, r.UpdateForm = false, true
+							}
+						case "security":
+							security[vvs[0]] = true
+							switch vvs[0] {
+							case "Create":
+								r.CreateSecurity = nil
+							case "Update":
+								r.UpdateSecurity = nil
+							case "Info":
+								r.InfoSecurity = nil
+							case "List":
+								r.ListSecurity = nil
+							case "Delete":
+								r.DeleteSecurity = nil
+							case "Trash":
+								r.TrashSecurity = nil
+							case "Restore":
+								r.RestoreSecurity = nil
+							case "Purge":
+								r.PurgeSecurity = nil
+							case "Batch":
+								r.BatchSecurity = nil
+							case "BatchUpdate":
+								r.BatchUpdateSecurity = nil
+							case "Upsert":
+								r.UpsertSecurity = nil
+							case "DeleteFilter":
+								r.DeleteFilterSecurity = nil
+							case "UpdateFilter":
+								r.UpdateFilterSecurity = nil
+							}
+						}
 					}
 					continue
 				}
@@ -195,6 +504,15 @@ func (m Mapper) Render() Render {
 				if len(vvs) == 2 {
 					ops := strings.Split(vvs[1], ";")
 					for _, v := range ops {
+						if isExtra(v) {
+							e, ok := r.OpExtra[vvs[0]]
+							if !ok {
+								e = Extra{}
+								r.OpExtra[vvs[0]] = e
+							}
+							e.Set(v)
+							continue
+						}
 						vs := strings.Split(v, "=")
 						switch vs[0] {
 						case "save":
@@ -221,8 +539,96 @@ func (m Mapper) Render() Render {
 								r.ListPreload = true
 								r.ListPreloadV = pvs
 							}
+						case "lock":
+							// Update:lock=update 在事务中加锁读取
+							if vs[1] != "update" && vs[1] != "share" {
+								logrus.Warnf("unknown lock: %s", vs[1])
+								break
+							}
+							switch vvs[0] {
+							case "Update":
+								r.UpdateLock = vs[1]
+							case "Delete":
+								r.DeleteLock = vs[1]
+							}
+						case "optimistic":
+							// Update:optimistic 使用版本号检查并发修改 Update Delete 都需要版本号
+							if vvs[0] == "Update" {
+								r.Optimistic = true
+							}
+						case "mode":
+							switch vvs[0] {
+							case "Update":
+								// Update:mode=patch 只更新请求中存在的字段
+								r.UpdatePatch = vs[1] == "patch"
+								if vs[1] != "patch" && vs[1] != "save" {
+									logrus.Warnf("unknown Update mode: %s", vs[1])
+								}
+							case "Batch", "BatchUpdate":
+								// Batch:mode=partial 跳过失败的数据 默认 atomic 全部成功或全部失败
+								if vs[1] != batchAtomic && vs[1] != batchPartial {
+									logrus.Warnf("unknown %s mode: %s", vvs[0], vs[1])
+								}
+								if vvs[0] == "Batch" {
+									r.BatchPartial = vs[1] == batchPartial
+								} else {
+									r.BatchUpdatePartial = vs[1] == batchPartial
+								}
+							}
+						case "max":
+							// Batch:max=500 单次请求的最大条数 DeleteFilter:max=100 最多删除的条数
+							n, err := strconv.Atoi(vs[1])
+							if err != nil || n <= 0 {
+								logrus.Warnf("invalid %s max: %s", vvs[0], vs[1])
+								break
+							}
+							switch vvs[0] {
+							case "Batch":
+								r.BatchMax = n
+							case "BatchUpdate":
+								r.BatchUpdateMax = n
+							case "DeleteFilter":
+								r.DeleteFilterMax = n
+							case "UpdateFilter":
+								r.UpdateFilterMax = n
+							case "Aggregate":
+								r.AggregateMax = n
+							}
+						case "paging":
+							// List:paging=cursor 按排序列的值分页 默认 offset
+							if vvs[0] != "List" {
+								break
+							}
+							if vs[1] != "cursor" && vs[1] != "offset" {
+								logrus.Warnf("unknown List paging: %s", vs[1])
+							}
+							r.ListCursor = vs[1] == "cursor"
+						case "sort":
+							// List:sort=-created_at,id 游标分页的排序列 - 为倒序
+							if vvs[0] == "List" {
+								listSort = vs[1]
+							}
+						case "total", "nototal":
+							// List:nototal 不计算总数
+							if vvs[0] == "List" {
+								r.ListTotal = vs[0] == "total"
+							}
+						case "key":
+							// Upsert:key=code 按唯一列查找 不存在时创建 存在时更新
+							if vvs[0] == "Upsert" {
+								r.Upsert = true
+								upsertKey = vs[1]
+							}
+						case "accept":
+							switch vvs[0] {
+							case "Create":
+								r.CreateJSON, r.CreateForm = parseAccept(vs[1])
+							case "Update":
+								r.UpdateJSON, r.UpdateForm = parseAccept(vs[1])
+							}
 						case "security":
 							sec := strings.Split(vs[1], ",")
+							security[vvs[0]] = true
 							switch vvs[0] {
 							case "Create":
 								r.CreateSecurity = sec
@@ -234,6 +640,22 @@ func (m Mapper) Render() Render {
 								r.ListSecurity = sec
 							case "Delete":
 								r.DeleteSecurity = sec
+							case "Trash":
+								r.TrashSecurity = sec
+							case "Restore":
+								r.RestoreSecurity = sec
+							case "Purge":
+								r.PurgeSecurity = sec
+							case "Batch":
+								r.BatchSecurity = sec
+							case "BatchUpdate":
+								r.BatchUpdateSecurity = sec
+							case "Upsert":
+								r.UpsertSecurity = sec
+							case "DeleteFilter":
+								r.DeleteFilterSecurity = sec
+							case "UpdateFilter":
+								r.UpdateFilterSecurity = sec
 							}
 						}
 					}
@@ -242,13 +664,112 @@ func (m Mapper) Render() Render {
 
 		}
 	}
+	if r.ModelImport != "" {
+		r.Model = "ext." + m.Name
+	}
+	// 未单独设置 security 的批量接口与 Create Update 相同
+	if !security["Batch"] {
+		r.BatchSecurity = r.CreateSecurity
+	}
+	if !security["BatchUpdate"] {
+		r.BatchUpdateSecurity = r.UpdateSecurity
+	}
+	// 按条件更新 删除与 Update Delete 相同
+	if !security["UpdateFilter"] {
+		r.UpdateFilterSecurity = r.UpdateSecurity
+	}
+	if !security["DeleteFilter"] {
+		r.DeleteFilterSecurity = r.DeleteSecurity
+	}
+	if !security["Upsert"] {
+		// Upsert 可以修改已存在的数据 使用 Update 的设置
+		r.UpsertSecurity = r.UpdateSecurity
+		if r.Upsert && strings.Join(r.CreateSecurity, ",") != strings.Join(r.UpdateSecurity, ",") {
+			logrus.Warnf("%s: Create and Update security differ, Upsert uses Update security, set Upsert:security to override", m.Name)
+		}
+	}
+	if r.Batch && !r.Create || r.BatchUpdate && !r.Update {
+		logrus.Fatalf("%s: Batch requires Create, BatchUpdate requires Update", m.Name)
+	}
+	if (r.Trash || r.Restore || r.Purge) && m.DeletedAt == "" {
+		logrus.Fatalf("%s: trash requires soft delete, add a DeletedAt field or embed gorm.Model", m.Name)
+	}
+	r.DeletedAt = m.DeletedAt
+	r.AggGroups = m.Groups
+	if r.List && r.ListCursor {
+		r.ListCursorColumns = cursorColumns(m, listSort)
+	}
+	r.AggFields = m.Aggs
+	if r.DeleteFilter && !r.Delete || r.UpdateFilter && !r.Update {
+		logrus.Fatalf("%s: DeleteFilter requires Delete, UpdateFilter requires Update", m.Name)
+	}
+	if r.Upsert {
+		if !r.Create || !r.Update {
+			logrus.Fatalf("%s: Upsert requires Create and Update", m.Name)
+		}
+		k, ok := findColumn(m.Columns, upsertKey)
+		if !ok {
+			logrus.Fatalf("%s: Upsert key %q does not match any column or field, use Upsert:key=column", m.Name, upsertKey)
+		}
+		if strings.HasPrefix(k.GoType, "*") || strings.HasPrefix(k.GoType, "sql.Null") {
+			logrus.Fatalf("%s: Upsert key %q can not be nullable", m.Name, upsertKey)
+		}
+		r.UpsertKey = k
+	}
+	for _, l := range m.Lookups {
+		if !r.Info {
+			logrus.Warnf("%s: lookup %s requires Info, skip", m.Name, l.Key.Param)
+			continue
+		}
+		if l.Update && !r.Update {
+			logrus.Warnf("%s: lookup %s update requires Update, skip", m.Name, l.Key.Param)
+			l.Update = false
+		}
+		if l.Delete && !r.Delete {
+			logrus.Warnf("%s: lookup %s delete requires Delete, skip", m.Name, l.Key.Param)
+			l.Delete = false
+		}
+		r.Lookups = append(r.Lookups, l)
+	}
+	r.HasKeys = r.Update || r.Info || r.Delete || r.Restore || r.Purge || r.BatchUpdate || r.Upsert
+	if r.HasKeys && len(m.Keys) == 0 {
+		logrus.Fatalf("%s: no primary key, required by Update Info Delete: add dbindex:\"col\", gorm:\"primary_key\" or an ID field", m.Name)
+	}
+	for _, k := range m.Keys {
+		r.KeyRoute += "/:" + k.Param
+		r.KeyPath += "/{" + k.Param + "}"
+	}
+	r.Keys = m.Keys
+	if r.Optimistic && r.Version == "" {
+		logrus.Fatalf("%s: optimistic requires a version:\"true\" or Version field", m.Name)
+	}
+
 	if r.Create {
 		r.CreateParams = []Attr{}
 		r.CreateParamsDecs = []string{}
 		for _, v := range m.Attr {
+			if r.Optimistic && v.Name == r.Version {
+				// 自动识别的 Version 字段同样由接口维护 不作为参数
+				continue
+			}
 			if p := v.Param("create"); p != "" {
 				r.CreateParamsDecs = append(r.CreateParamsDecs, p)
 				r.CreateParams = append(r.CreateParams, v)
+				if r.Upsert && v.Name == r.UpsertKey.Name {
+					r.UpsertCreate = true
+				}
+				if v.File {
+					r.CreateFile = true
+				}
+				if v.Encoding != "" || v.Null {
+					r.CreateEncoded = true
+				}
+				if v.Encoding == "time" {
+					r.CreateTime = true
+				}
+				if v.NullKind != "" {
+					r.CreateNullable = true
+				}
 			}
 		}
 	}
@@ -256,29 +777,202 @@ func (m Mapper) Render() Render {
 		r.UpdateParams = []Attr{}
 		r.UpdateParamsDecs = []string{}
 		for _, v := range m.Attr {
+			if r.Optimistic && v.Name == r.Version {
+				// 自动识别的 Version 字段同样由接口维护 不作为参数
+				continue
+			}
 			if p := v.Param("update"); p != "" {
 				r.UpdateParamsDecs = append(r.UpdateParamsDecs, p)
 				r.UpdateParams = append(r.UpdateParams, v)
+				if r.Upsert && v.Name == r.UpsertKey.Name {
+					r.UpsertUpdate = true
+				}
+				if v.File {
+					r.UpdateFile = true
+				}
+				if v.Encoding != "" || v.Null {
+					r.UpdateEncoded = true
+				}
+				if v.Encoding == "time" {
+					r.UpdateTime = true
+				}
+				if v.NullKind != "" {
+					r.UpdateNullable = true
+				}
 			}
 		}
 	}
+	for _, v := range m.Attr {
+		if r.Create && v.Param("create") != "" || r.Update && v.Param("update") != "" {
+			r.TimeBounds = append(r.TimeBounds, v.TimeBounds()...)
+		}
+	}
 
 	return r
 }
 
+// 批量接口的模式 与 batch 包相同
+const (
+	batchAtomic  = "atomic"
+	batchPartial = "partial"
+)
+
+// cursorColumns 游标分页的排序列 最后加入主键保证顺序唯一
+func cursorColumns(m Mapper, sort string) []SortColumn {
+	cs := []SortColumn{}
+	for _, v := range splitColumns(sort) {
+		desc := strings.HasPrefix(v, "-")
+		k, ok := findColumn(m.Columns, strings.TrimPrefix(v, "-"))
+		if !ok {
+			logrus.Fatalf("%s: List sort %q does not match any column or field", m.Name, v)
+		}
+		if strings.HasPrefix(k.GoType, "*") || strings.HasPrefix(k.GoType, "sql.Null") {
+			logrus.Fatalf("%s: List sort %q can not be nullable", m.Name, v)
+		}
+		cs = append(cs, SortColumn{Key: k, Desc: desc})
+	}
+	if len(m.Keys) == 0 {
+		logrus.Fatalf("%s: List paging=cursor requires a primary key", m.Name)
+	}
+	for _, k := range m.Keys {
+		has := false
+		for _, c := range cs {
+			has = has || c.Column == k.Column
+		}
+		if !has {
+			cs = append(cs, SortColumn{Key: k})
+		}
+	}
+	return cs
+}
+
+// SortColumn 排序列
+type SortColumn struct {
+	Key
+	Desc bool
+}
+
+// findColumn 查找列 可以是列名或字段名
+func findColumn(columns map[string]Key, s string) (Key, bool) {
+	for c, k := range columns {
+		if s == "" || (c != s && k.Name != s) {
+			continue
+		}
+		k.Column = c
+		k.Param = c
+		k.Type = keyType(k.GoType)
+		return k, true
+	}
+	return Key{}, false
+}
+
+// parseAccept 解析请求格式 json,form
+func parseAccept(s string) (bool, bool) {
+	j, f := false, false
+	for _, v := range strings.Split(s, ",") {
+		switch strings.TrimSpace(v) {
+		case "json":
+			j = true
+		case "form":
+			f = true
+		default:
+			logrus.Warnf("unknown accept: %s", v)
+		}
+	}
+	if !j && !f {
+		f = true
+	}
+	return j, f
+}
+
+// Lookup 按唯一列查询 GET /by-slug/:slug
+type Lookup struct {
+	Key    Key  // Param 为路由中的名称
+	Update bool // POST /by-slug/:slug
+	Delete bool // DELETE /by-slug/:slug
+}
+
+// AggField 可以分组或聚合的字段
+type AggField struct {
+	Name   string
+	Column string
+	JSON   string
+	GoType string // 分组时为结果的类型 可以为 null
+	Funcs  []AggFunc
+}
+
+// AggFunc 字段的聚合函数
+type AggFunc struct {
+	Key   string // 请求参数 sum:amount
+	Func  string // SQL 函数 SUM
+	Field string // 结果结构中的字段名 SumAmount
+	Alias string // 列别名 sum_amount
+	JSON  string // 返回的字段名 sum_amount
+}
+
+// Key 主键字段
+type Key struct {
+	Name   string // 字段名
+	Column string // 列名
+	Param  string // 路径参数名 单列主键为 id
+	GoType string
+	Type   string // swagger 类型 integer string
+}
+
 type Attr struct {
-	Name      string
-	Type      string
-	CtxFunc   string
-	IToM      string
-	JSON      string
-	Enums     string
-	MaxLength string
-	MinLength string
-	Max       string
-	Min       string
-	Params    string
-	Desc      string
+	Name       string
+	Type       string
+	CtxFunc    string
+	IToM       string
+	GoType     string // 字段类型
+	ReqType    string // 请求参数结构中的类型
+	NullKind   string // 可为空的字段 ptr 指针 sql sql.NullX
+	NullField  string // sql.NullX 的值字段
+	Null       bool   // null:"true" 空值表示 null
+	Encoding   string // 复合类型的编码 multi csv json time
+	TimeFormat string // 时间格式 rfc3339 unix unixmilli date 或自定义 layout
+	TimeZone   string // 时区 Asia/Shanghai 默认为本地时区
+	JSON       string
+	Enums      string
+	MaxLength  string
+	MinLength  string
+	Max        string
+	Min        string
+	Pattern    string
+	Format     string
+	File       bool   // pt:"file" 上传文件 字段保存文件地址
+	MaxSize    string // 文件最大字节数
+	Mime       string // 文件类型 image/png,image/*
+	Params     string
+	Desc       string
+	Extra      Extra
+}
+
+// Extra 自定义注解 以 x- 开头的选项原样传递给模板
+type Extra map[string]string
+
+func isExtra(s string) bool {
+	return strings.HasPrefix(s, "x-")
+}
+
+// Set 解析 x-key=value 或 x-key
+func (e Extra) Set(s string) {
+	if i := strings.Index(s, "="); i > -1 {
+		e[s[:i]] = s[i+1:]
+	} else {
+		e[s] = ""
+	}
+}
+
+// Has 是否存在该注解
+func (e Extra) Has(k string) bool {
+	_, ok := e[k]
+	return ok
+}
+
+// Get 获取注解值 不存在返回空
+func (e Extra) Get(k string) string {
+	return e[k]
 }
 
 // Param 获取接口文档参数说明
@@ -318,19 +1012,166 @@ func (a Attr) Param(t string) string {
 			f += " %s"
 			as = append(as, "minLength("+a.MinLength+")")
 		}
-		if a.Max != "" {
+		if a.Max != "" && a.Encoding != "time" {
 			f += " %s"
 			as = append(as, "maxinum("+a.Max+")")
 		}
-		if a.Min != "" {
+		if a.Min != "" && a.Encoding != "time" {
 			f += " %s"
 			as = append(as, "mininum("+a.Min+")")
 		}
+		if a.Pattern != "" {
+			f += " %s"
+			as = append(as, "pattern("+a.Pattern+")")
+		}
+		if validateFormats[a.Format] {
+			f += " %s"
+			as = append(as, "format("+a.Format+")")
+		}
+		if a.NullKind != "" {
+			f += " %s"
+			as = append(as, "extensions(x-nullable)")
+		}
+		switch a.Encoding {
+		case "multi", "csv":
+			f += " %s"
+			as = append(as, "collectionFormat("+a.Encoding+")")
+		case "json":
+			f += " %s"
+			as = append(as, "format(json)")
+		case "time":
+			switch a.TimeFormat {
+			case "", "rfc3339":
+				f += " %s"
+				as = append(as, "format(date-time)")
+			case "date":
+				f += " %s"
+				as = append(as, "format(date)")
+			}
+		}
 		return fmt.Sprintf(f, as...)
 	}
 	return ""
 }
 
+// FileCheck 生成上传文件校验代码 r为请求参数
+func (a Attr) FileCheck() string {
+	as := []string{strconv.Quote(a.JSON), "r." + a.Name + "File", "0"}
+	if a.MaxSize != "" {
+		as[2] = a.MaxSize
+	}
+	if a.Mime != "" {
+		for _, m := range strings.Split(a.Mime, ",") {
+			as = append(as, strconv.Quote(strings.TrimSpace(m)))
+		}
+	}
+	return "v.File(" + strings.Join(as, ", ") + ")"
+}
+
+// validateFormats 运行时校验支持的 format
+var validateFormats = map[string]bool{"email": true, "uuid": true, "url": true}
+
+// Validate 生成参数校验代码 o为参数值 v为 validate.Validator
+func (a Attr) Validate() []string {
+	vs := []string{}
+	num := func(rule, s string) bool {
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			logrus.Warnf("%s %s=%q is not a number, skip", a.Name, rule, s)
+			return false
+		}
+		return true
+	}
+	// 长度限制生成 int 参数 不接受小数
+	length := func(rule, s string) bool {
+		if _, err := strconv.Atoi(s); err != nil {
+			logrus.Warnf("%s %s=%q is not an integer, skip", a.Name, rule, s)
+			return false
+		}
+		return true
+	}
+	switch a.CtxFunc {
+	case "String":
+		if a.MaxLength != "" && length("maxlength", a.MaxLength) {
+			vs = append(vs, fmt.Sprintf("v.MaxLength(%q, string(o), %s)", a.JSON, a.MaxLength))
+		}
+		if a.MinLength != "" && length("minlength", a.MinLength) {
+			vs = append(vs, fmt.Sprintf("v.MinLength(%q, string(o), %s)", a.JSON, a.MinLength))
+		}
+		if a.Pattern != "" {
+			if _, err := regexp.Compile(a.Pattern); err != nil {
+				logrus.Warnf("%s pattern=%q error: %s, skip", a.Name, a.Pattern, err)
+			} else {
+				vs = append(vs, fmt.Sprintf("v.Pattern(%q, string(o), %q)", a.JSON, a.Pattern))
+			}
+		}
+		if validateFormats[a.Format] {
+			vs = append(vs, fmt.Sprintf("v.Format(%q, string(o), %q)", a.JSON, a.Format))
+		}
+	case "":
+		if a.Encoding != "time" {
+			return vs
+		}
+		if a.Min != "" {
+			vs = append(vs, fmt.Sprintf("v.TimeMin(%q, o, %s)", a.JSON, a.timeBound("min", a.Min)))
+		}
+		if a.Max != "" {
+			vs = append(vs, fmt.Sprintf("v.TimeMax(%q, o, %s)", a.JSON, a.timeBound("max", a.Max)))
+		}
+		return vs
+	case "Int64", "Float64":
+		if a.Max != "" && num("max", a.Max) {
+			vs = append(vs, fmt.Sprintf("v.Max(%q, float64(o), %s)", a.JSON, a.Max))
+		}
+		if a.Min != "" && num("min", a.Min) {
+			vs = append(vs, fmt.Sprintf("v.Min(%q, float64(o), %s)", a.JSON, a.Min))
+		}
+	default:
+		return vs
+	}
+	if a.Enums != "" {
+		es := []string{}
+		for _, e := range strings.Split(a.Enums, ",") {
+			es = append(es, strconv.Quote(strings.TrimSpace(e)))
+		}
+		vs = append(vs, fmt.Sprintf("v.Enums(%q, o, %s)", a.JSON, strings.Join(es, ", ")))
+	}
+	return vs
+}
+
+// timeBound 时间范围的变量名 now 在请求时取当前时间
+func (a Attr) timeBound(rule, s string) string {
+	if s == "now" {
+		return "time.Now()"
+	}
+	return "time" + strings.Title(rule) + a.Name
+}
+
+// TimeBound 时间参数的范围 生成的代码在启动时按参数的格式与时区解析
+type TimeBound struct {
+	Var    string
+	Value  string
+	Format string
+	Zone   string
+}
+
+// TimeBounds 生成时校验时间范围的格式 时区为空时使用运行时的本地时区
+func (a Attr) TimeBounds() []TimeBound {
+	if a.Encoding != "time" {
+		return nil
+	}
+	bs := []TimeBound{}
+	for _, b := range [][2]string{{"min", a.Min}, {"max", a.Max}} {
+		if b[1] == "" || b[1] == "now" {
+			continue
+		}
+		if _, err := bind.ParseTime(b[1], a.TimeFormat, a.TimeZone); err != nil {
+			logrus.Fatalf("%s %s=%q error: %s", a.Name, b[0], b[1], err)
+		}
+		bs = append(bs, TimeBound{Var: a.timeBound(b[0], b[1]), Value: b[1], Format: a.TimeFormat, Zone: a.TimeZone})
+	}
+	return bs
+}
+
 type MFunc struct {
 	Name string
 	Sort int64
@@ -375,7 +1216,8 @@ func (f Func) Check(n string) *MFunc {
 }
 
 type File struct {
-	g *Generator
+	g    *Generator
+	name string // 文件名
 
 	imp  []string
 	pkg  *Package
@@ -385,13 +1227,16 @@ type File struct {
 
 	trimPrefix  string
 	lineComment bool
+	external    bool // 外部注解文件引用的包 仅解析声明的模型
 }
 
 type Package struct {
-	Name  string
-	Path  string
-	defs  map[*ast.Ident]types.Object
-	files []*File
+	Name    string
+	Path    string
+	Default []string // 包默认注解 // @tg-default
+	defs    map[*ast.Ident]types.Object
+	types   map[ast.Expr]types.TypeAndValue
+	files   []*File
 }
 
 type Render struct {
@@ -400,12 +1245,26 @@ type Render struct {
 	Project     string
 	Name        string
 	DBIndex     string
-	Desc        string
+	Desc        string   // 接口名称 desc= 或注释第一行
+	Tag         string   // 文档分组 desc= 或类型名
+	Description []string // 接口详细说明 模型注释中 @tg 以外的内容
+	Model       string   // 模型类型 models.User
+	ModelImport string   // 模型不在当前包时的包路径 导入为 ext
+
+	Extra   Extra            // 模型自定义注解 x-cache=30s
+	OpExtra map[string]Extra // 接口自定义注解 List:x-export=csv
 
 	Create           bool
 	CreateSave       bool
+	CreateJSON       bool // 接受 application/json
+	CreateForm       bool // 接受 x-www-form-urlencoded
+	CreateFile       bool // 存在上传文件参数 接受 multipart/form-data
+	CreateEncoded    bool // 存在复合类型参数 需要读取 form
+	CreateNullable   bool // 存在可为空的参数
+	CreateTime       bool // 存在时间参数 json 请求体按 timeformat 解析
 	CreateParams     []Attr
 	CreateParamsDecs []string
+	TimeBounds       []TimeBound // Create Update 参数的时间范围
 	CreateBefore     []MFunc
 	CreateTxBefore   []MFunc
 	CreateTxAfter    []MFunc
@@ -414,6 +1273,14 @@ type Render struct {
 
 	Update           bool
 	UpdateSave       bool
+	UpdateJSON       bool
+	UpdateForm       bool
+	UpdateFile       bool
+	UpdateEncoded    bool
+	UpdateNullable   bool
+	UpdateTime       bool   // 存在时间参数 json 请求体按 timeformat 解析
+	UpdatePatch      bool   // mode=patch 只更新请求中存在的字段
+	UpdateLock       string // lock=update 在事务中加锁读取 update share
 	UpdateParams     []Attr
 	UpdateParamsDecs []string
 	UpdateBefore     []MFunc
@@ -422,12 +1289,26 @@ type Render struct {
 	UpdateAfter      []MFunc
 	UpdateSecurity   []string
 
+	UpdateFilter         bool // PATCH /?filters= 按条件更新
+	UpdateFilterMax      int  // max=100 最多更新的条数
+	UpdateFilterSecurity []string
+
 	List         bool
 	ListPreload  bool
 	ListPreloadV []string
 	ListBefore   []MFunc
 	ListAfter    []MFunc
 	ListSecurity []string
+	ListTotal    bool // nototal 不计算总数
+	ListCursor   bool // paging=cursor 游标分页
+
+	ListCursorColumns []SortColumn // sort=-created_at 游标分页的排序列
+
+	Count        bool       // GET /count 条件与权限与 List 相同
+	Aggregate    bool       // GET /aggregate?group=status&agg=sum:amount
+	AggregateMax int        // max=1000 最多返回的分组数
+	AggGroups    []AggField // 可以分组的字段
+	AggFields    []AggField // 可以聚合的字段
 
 	Info         bool
 	InfoPreload  bool
@@ -437,9 +1318,62 @@ type Render struct {
 	InfoSecurity []string
 
 	Delete         bool
+	DeleteLock     string // lock=update 在事务中加锁检查是否存在
 	DeleteBefore   []MFunc
 	DeleteTxBefore []MFunc
 	DeleteTxAfter  []MFunc
 	DeleteAfter    []MFunc
 	DeleteSecurity []string
+
+	DeleteFilter         bool // DELETE /?filters= 按条件删除 需要 confirm=true
+	DeleteFilterMax      int  // max=100 最多删除的条数
+	DeleteFilterSecurity []string
+
+	DeletedAt string // 软删除列
+
+	Trash         bool // GET /trash 回收站列表
+	TrashBefore   []MFunc
+	TrashAfter    []MFunc
+	TrashSecurity []string
+
+	Restore         bool // POST /:id/restore 恢复
+	RestoreBefore   []MFunc
+	RestoreTxBefore []MFunc
+	RestoreTxAfter  []MFunc
+	RestoreAfter    []MFunc
+	RestoreSecurity []string
+
+	Purge         bool // DELETE /:id/purge 彻底删除回收站中的数据
+	PurgeBefore   []MFunc
+	PurgeTxBefore []MFunc
+	PurgeTxAfter  []MFunc
+	PurgeAfter    []MFunc
+	PurgeSecurity []string
+
+	Batch               bool // POST /batch 批量创建
+	BatchPartial        bool // mode=partial 跳过失败的数据
+	BatchMax            int  // max=1000 单次请求的最大条数
+	BatchSecurity       []string
+	BatchUpdate         bool // POST /batch-update 批量更新
+	BatchUpdatePartial  bool
+	BatchUpdateMax      int
+	BatchUpdateSecurity []string
+
+	Upsert         bool // PUT /by-key/:key 不存在时创建 存在时更新
+	UpsertKey      Key  // key=code 查找的唯一列
+	UpsertCreate   bool // 唯一列是创建参数 使用路径中的值
+	UpsertUpdate   bool // 唯一列是更新参数 忽略请求中的值
+	UpsertSecurity []string
+
+	Lookups []Lookup // 按唯一列查询 与 Info 相同的预加载 Func 权限
+
+	Keys     []Key
+	HasKeys  bool   // 存在需要主键的接口
+	KeyRoute string // 主键路由 /:id  /:tenant_id/:code
+	KeyPath  string // 文档中的路径 /{id}
+
+	Optimistic    bool // Update Delete 需要版本号
+	Version       string
+	VersionColumn string
+	VersionJSON   string
 }
@@ -0,0 +1,42 @@
+package generate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAttrValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		a    Attr
+		want []string
+	}{
+		{"length", Attr{Name: "Name", JSON: "name", CtxFunc: "String", MaxLength: "10", MinLength: "2"},
+			[]string{`v.MaxLength("name", string(o), 10)`, `v.MinLength("name", string(o), 2)`}},
+		{"float length", Attr{Name: "Name", JSON: "name", CtxFunc: "String", MaxLength: "10.5", MinLength: "x"}, []string{}},
+		{"float max", Attr{Name: "Age", JSON: "age", CtxFunc: "Float64", Max: "10.5", Min: "a"},
+			[]string{`v.Max("age", float64(o), 10.5)`}},
+		{"enums", Attr{Name: "Age", JSON: "age", CtxFunc: "Int64", Enums: "1, 2"},
+			[]string{`v.Enums("age", o, "1", "2")`}},
+		{"pattern", Attr{Name: "Name", JSON: "name", CtxFunc: "String", Pattern: "(", Format: "email"},
+			[]string{`v.Format("name", string(o), "email")`}},
+		{"time", Attr{Name: "Birthday", JSON: "birthday", Encoding: "time", TimeFormat: "date", TimeZone: "Asia/Shanghai", Min: "1900-01-01", Max: "now"},
+			[]string{`v.TimeMin("birthday", o, timeMinBirthday)`, `v.TimeMax("birthday", o, time.Now())`}},
+		{"bool", Attr{Name: "Ok", JSON: "ok", CtxFunc: "Bool", Enums: "true"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Validate(); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("want %v got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAttrTimeBounds(t *testing.T) {
+	a := Attr{Name: "Birthday", Encoding: "time", TimeFormat: "date", Min: "1900-01-01", Max: "now"}
+	want := []TimeBound{{Var: "timeMinBirthday", Value: "1900-01-01", Format: "date"}}
+	if got := a.TimeBounds(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v got %v", want, got)
+	}
+}
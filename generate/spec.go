@@ -0,0 +1,135 @@
+package generate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/tools/go/packages"
+	"gopkg.in/yaml.v2"
+)
+
+// Spec 外部注解文件 yaml/json
+// 用于无法添加 // @tg 注释的模型 例如来自其他模块的模型
+type Spec struct {
+	Models []*ModelSpec `yaml:"models"`
+	Funcs  []FuncSpec   `yaml:"funcs"`
+}
+
+// ModelSpec 模型声明 与 // @tg 注释语义相同
+type ModelSpec struct {
+	Package string                       `yaml:"package"` // 模型所在包 默认为当前包
+	Name    string                       `yaml:"name"`    // 类型名
+	TG      string                       `yaml:"tg"`      // @tg 之后的内容
+	Fields  map[string]map[string]string `yaml:"fields"`  // 字段注解 与 struct tag 相同 params maxlength ...
+}
+
+// FuncSpec 方法注册 方法需在当前包中
+type FuncSpec struct {
+	Name string `yaml:"name"`
+	TG   string `yaml:"tg"`
+}
+
+// ParseSpec 加载外部注解文件 需在 ParsePackage 之后调用
+func (g *Generator) ParseSpec(path string, tags []string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		logrus.Fatalln("Load spec[", path, "] error:", err)
+	}
+	spec := Spec{}
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		logrus.Fatalln("Parse spec[", path, "] error:", err)
+	}
+
+	// 方法在解析注释之后注册 重复时以注释为准
+	g.SpecFunc = append(g.SpecFunc, spec.Funcs...)
+
+	patterns := []string{}
+	for _, ms := range spec.Models {
+		if ms.Package == "" {
+			ms.Package = g.Pkg.Path
+		}
+		key := ms.Package + "." + ms.Name
+		if _, ok := g.Spec[key]; ok {
+			logrus.Fatalf("spec: %s declared more than once", key)
+		}
+		g.Spec[key] = ms
+		if ms.Package != g.Pkg.Path {
+			patterns = append(patterns, ms.Package)
+		}
+	}
+	if len(patterns) == 0 {
+		return
+	}
+
+	cfg := &packages.Config{
+		Mode:       packages.LoadSyntax,
+		Tests:      false,
+		BuildFlags: []string{fmt.Sprintf("-tags=%s", strings.Join(tags, " "))},
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		logrus.Fatalln("Load spec packages error:", err)
+	}
+	for _, pkg := range pkgs {
+		p := &Package{
+			Name:  pkg.Name,
+			Path:  pkg.PkgPath,
+			defs:  pkg.TypesInfo.Defs,
+			types: pkg.TypesInfo.Types,
+			files: make([]*File, len(pkg.Syntax)),
+		}
+		for i, file := range pkg.Syntax {
+			p.files[i] = &File{
+				g:           g,
+				name:        filepath.Base(pkg.Fset.File(file.Pos()).Name()),
+				file:        file,
+				imp:         make([]string, 0),
+				pkg:         p,
+				mappers:     []Mapper{},
+				trimPrefix:  g.TrimPrefix,
+				lineComment: g.LineComment,
+				external:    true,
+			}
+		}
+		g.Ext = append(g.Ext, p)
+	}
+}
+
+// mergeAPI 合并注释与外部注解文件 注释优先 冲突时输出警告
+func mergeAPI(name, api, spec string) string {
+	if api == "" {
+		return strings.TrimSpace("@tg " + spec)
+	}
+	ao := apiOptions(api)
+	for k, v := range apiOptions(spec) {
+		if av, ok := ao[k]; ok && av != v {
+			logrus.Warnf("conflict: %s %s=%q in comment, %q in spec, use comment", name, k, av, v)
+		}
+	}
+	// 注解按顺序执行 注释放在后面以覆盖外部声明
+	return strings.TrimSpace("@tg " + spec + " " + strings.TrimSpace(strings.TrimPrefix(api, "@tg")))
+}
+
+// apiOptions 将注解展开为 key=value 用于冲突检查 接口选项的key为 Create:preload
+func apiOptions(api string) map[string]string {
+	m := map[string]string{}
+	for _, v := range strings.Fields(api) {
+		if v == "@tg" || strings.HasPrefix(v, "-") {
+			continue
+		}
+		if !isExtra(v) && strings.Index(v, ":") > -1 {
+			vs := strings.SplitN(v, ":", 2)
+			for _, o := range strings.Split(vs[1], ";") {
+				ovs := strings.SplitN(o, "=", 2)
+				m[vs[0]+":"+ovs[0]] = strings.Join(ovs[1:], "")
+			}
+			continue
+		}
+		vs := strings.SplitN(v, "=", 2)
+		m[vs[0]] = strings.Join(vs[1:], "")
+	}
+	return m
+}
@@ -9,13 +9,29 @@ var (
 package {{.PackageName}}
 
 import (
-    {{if .Delete}}
+    {{if or .HasKeys .CreateJSON}}
     "strings"
     {{end}}
 
-    {{if or .Update .Info}}
+    {{if .HasKeys}}
     "github.com/nzlov/gorm"
+    {{end}}
 	"github.com/labstack/echo/v4"
+
+    {{if or .Create .Update}}
+    "github.com/nzlov/tg/validate"
+    {{end}}
+    {{if or .CreateEncoded .UpdateEncoded .CreateNullable .UpdateNullable .HasKeys .TimeBounds}}
+    "github.com/nzlov/tg/bind"
+    {{end}}
+    {{if or .CreateFile .UpdateFile}}
+    "github.com/nzlov/tg/storage"
+    {{end}}
+    {{if or .UpdateLock .DeleteLock}}
+    "github.com/nzlov/tg/lock"
+    {{end}}
+    {{if or .Batch .BatchUpdate}}
+    "github.com/nzlov/tg/batch"
     {{end}}
 
     "gogs.yunss.com/go/thirds/sqldb"
@@ -23,6 +39,9 @@ import (
 
 	"{{.Project}}/app/ctx"
 	"{{.Project}}/app/models"
+    {{if .ModelImport}}
+    ext "{{.ModelImport}}"
+    {{end}}
 	"{{.Project}}/app/global"
 )
 
@@ -33,248 +52,1792 @@ func TgInit(e *echo.Echo) {
 	r.POST("", ctx.Handler(Create))
     {{end}}
     {{if .Update}}
-    r.POST("/:id", ctx.Handler(Update))
+    r.POST("{{.KeyRoute}}", ctx.Handler(Update))
     {{end}}
     {{if .List}}
     r.GET("", ctx.Handler(List))
     {{end}}
+    {{if .Count}}
+    r.GET("/count", ctx.Handler(Count))
+    {{end}}
+    {{if .Aggregate}}
+    r.GET("/aggregate", ctx.Handler(Aggregate))
+    {{end}}
     {{if .Info}}
-    r.GET("/:id", ctx.Handler(Info))
+    r.GET("{{.KeyRoute}}", ctx.Handler(Info))
     {{end}}
     {{if .Delete}}
-    r.DELETE("/:id", ctx.Handler(Delete))
+    r.DELETE("{{.KeyRoute}}", ctx.Handler(Delete))
+    {{end}}
+    {{if .UpdateFilter}}
+    r.PATCH("", ctx.Handler(UpdateFilter))
+    {{end}}
+    {{if .DeleteFilter}}
+    r.DELETE("", ctx.Handler(DeleteFilter))
+    {{end}}
+    {{if .Trash}}
+    r.GET("/trash", ctx.Handler(Trash))
+    {{end}}
+    {{if .Restore}}
+    r.POST("{{.KeyRoute}}/restore", ctx.Handler(Restore))
+    {{end}}
+    {{if .Purge}}
+    r.DELETE("{{.KeyRoute}}/purge", ctx.Handler(Purge))
+    {{end}}
+    {{if .Batch}}
+    r.POST("/batch", ctx.Handler(BatchCreate))
     {{end}}
+    {{if .BatchUpdate}}
+    r.POST("/batch-update", ctx.Handler(BatchUpdate))
+    {{end}}
+    {{range .Lookups}}
+    r.GET("/by-{{.Key.Param}}/:{{.Key.Param}}", ctx.Handler(InfoBy{{.Key.Name}}))
+    {{- if .Update}}
+    r.POST("/by-{{.Key.Param}}/:{{.Key.Param}}", ctx.Handler(UpdateBy{{.Key.Name}}))
+    {{- end}}
+    {{- if .Delete}}
+    r.DELETE("/by-{{.Key.Param}}/:{{.Key.Param}}", ctx.Handler(DeleteBy{{.Key.Name}}))
+    {{- end}}
+    {{end}}
+    {{if .Upsert}}
+    r.PUT("/by-{{.UpsertKey.Param}}/:{{.UpsertKey.Param}}", ctx.Handler(Upsert))
+    {{end}}
+}
+
+{{- with .TimeBounds}}
+// 时间参数的范围 启动时按参数的格式与时区解析
+var (
+    {{- range .}}
+    {{.Var}} = bind.MustParseTime({{printf "%q" .Value}}, {{printf "%q" .Format}}, {{printf "%q" .Zone}})
+    {{- end}}
+)
+{{end}}
+{{if .HasKeys}}
+// Key {{.Desc}}主键
+type Key struct {
+    {{- range .Keys}}
+    {{.Name}} {{.GoType}} ` + "`json:\"{{.Param}}\"`" + `
+    {{- end}}
+}
+
+// ParseKeys 读取路径中的主键 多个以逗号分隔
+func ParseKeys(ctx *ctx.Context) ([]Key, error) {
+    {{- range $i, $k := .Keys}}
+    s{{$i}} := strings.Split(ctx.Param("{{.Param}}"), ",")
+    {{- if $i}}
+    if len(s{{$i}}) != len(s0) {
+        return nil, errors.New("{{.Param}}: count mismatch")
+    }
+    {{- end}}
+    {{- end}}
+    keys := make([]Key, len(s0))
+    for i := range keys {
+        {{- range $i, $k := .Keys}}
+        if err := bind.Key(s{{$i}}[i], &keys[i].{{.Name}}); err != nil {
+            return nil, fmt.Errorf("{{.Param}}: %s", err)
+        }
+        {{- end}}
+    }
+    return keys, nil
+}
+
+// WhereKeys 主键条件
+func WhereKeys(db *gorm.DB, keys []Key) *gorm.DB {
+    {{- if eq (len .Keys) 1}}
+    {{- with index .Keys 0}}
+    vs := make([]{{.GoType}}, len(keys))
+    for i, k := range keys {
+        vs[i] = k.{{.Name}}
+    }
+    return db.Where("{{.Column}} in (?)", vs)
+    {{- end}}
+    {{- else}}
+    conds := make([]string, len(keys))
+    args := []interface{}{}
+    for i, k := range keys {
+        conds[i] = "({{range $i, $k := .Keys}}{{if $i}} AND {{end}}{{.Column}} = ?{{end}})"
+        args = append(args{{range .Keys}}, k.{{.Name}}{{end}})
+    }
+    return db.Where(strings.Join(conds, " OR "), args...)
+    {{- end}}
+}
+{{end}}
+
+{{if .Create}}
+// CreateRequest 创建{{.Desc}}参数 未提供的参数为nil
+type CreateRequest struct {
+    {{- range .CreateParams}}
+    {{- if ne .CtxFunc "-"}}
+    // {{.Desc}}
+    {{- if .File}}
+    {{.Name}} *{{.ReqType}} ` + "`json:\"-\"`" + `
+    {{.Name}}File *multipart.FileHeader ` + "`json:\"-\"`" + `
+    {{- else}}
+    {{.Name}} *{{.ReqType}} ` + "`json:\"{{.JSON}},omitempty\"`" + `
+    {{- end}}
+    {{- end}}
+    {{- end}}
+    {{- if .CreateNullable}}
+    // 显式设置为 null 的参数
+    Null []string ` + "`json:\"-\"`" + `
+    {{- end}}
+    {{- if .CreateFile}}
+    // 已保存的文件地址
+    uploaded []string
+    {{- end}}
+}
+{{- if .CreateNullable}}
+
+// IsNull 参数是否显式设置为 null
+func (r CreateRequest) IsNull(key string) bool {
+    for _, v := range r.Null {
+        if v == key {
+            return true
+        }
+    }
+    return false
+}
+{{- end}}
+
+{{- if .CreateTime}}
+
+// UnmarshalJSON json 请求体中的时间参数与表单相同 按 timeformat timezone 解析
+func (r *CreateRequest) UnmarshalJSON(data []byte) error {
+    type plain CreateRequest
+    p := struct {
+        *plain
+        {{- range .CreateParams}}
+        {{- if eq .Encoding "time"}}
+        {{.Name}} json.RawMessage ` + "`json:\"{{.JSON}}\"`" + `
+        {{- end}}
+        {{- end}}
+    }{plain: (*plain)(r)}
+    if err := json.Unmarshal(data, &p); err != nil {
+        return err
+    }
+    {{- range .CreateParams}}
+    {{- if eq .Encoding "time"}}
+    if err := bind.RawTime(p.{{.Name}}, "{{.JSON}}", {{printf "%q" .TimeFormat}}, {{printf "%q" .TimeZone}}, &r.{{.Name}}); err != nil {
+        return err
+    }
+    {{- end}}
+    {{- end}}
+    return nil
+}
+{{- end}}
+
+// BindCreateRequest 读取创建参数
+func BindCreateRequest(ctx *ctx.Context) (CreateRequest, error) {
+    r := CreateRequest{}
+    {{- if .CreateJSON}}
+    if strings.HasPrefix(ctx.Request().Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+        {{- if .CreateNullable}}
+        data, err := ioutil.ReadAll(ctx.Request().Body)
+        if err != nil {
+            return r, err
+        }
+        if err := json.Unmarshal(data, &r); err != nil {
+            return r, err
+        }
+        r.Null = bind.Nulls(data{{range .CreateParams}}{{if .NullKind}}, "{{.JSON}}"{{end}}{{end}})
+        return r, nil
+        {{- else}}
+        err := json.NewDecoder(ctx.Request().Body).Decode(&r)
+        return r, err
+        {{- end}}
+    }
+    {{- end}}
+    {{- if .CreateForm}}
+    {{- if .CreateEncoded}}
+    form, err := ctx.FormParams()
+    if err != nil {
+        return r, err
+    }
+    {{- end}}
+    {{- range .CreateParams}}
+    {{- if ne .CtxFunc "-"}}
+    {{- if .Null}}
+    if bind.Null(form, "{{.JSON}}") {
+        r.Null = append(r.Null, "{{.JSON}}")
+    }
+    {{- end}}
+    {{- if .File}}
+    // 文件地址只能通过上传设置
+    if fh, err := ctx.FormFile("{{.JSON}}"); err == nil {
+        r.{{.Name}}File = fh
+    }
+    {{- else if eq .Encoding "json"}}
+    if err := bind.JSON(form, "{{.JSON}}", &r.{{.Name}}); err != nil {
+        return r, err
+    }
+    {{- else if eq .Encoding "time"}}
+    if err := bind.Time(form, "{{.JSON}}", {{printf "%q" .TimeFormat}}, {{printf "%q" .TimeZone}}, &r.{{.Name}}); err != nil {
+        return r, err
+    }
+    {{- else if .Encoding}}
+    if err := bind.Slice(form, "{{.JSON}}", "{{.Encoding}}", &r.{{.Name}}); err != nil {
+        return r, err
+    }
+    {{- else if eq .CtxFunc "@"}}
+    if o,ok:=ctx.Getv("{{.JSON}}");ok{
+        v := o.({{.IToM}})
+        r.{{.Name}} = &v
+    }
+    {{- else}}
+    if o,ok:=ctx.Get{{.CtxFunc}}v("{{.JSON}}");ok{{if .Null}}&&!r.IsNull("{{.JSON}}"){{end}}{
+        v := {{.ReqType}}(o)
+        r.{{.Name}} = &v
+    }
+    {{- end}}
+    {{- end}}
+    {{- end}}
+    return r, nil
+    {{- else}}
+    return r, errors.New("unsupported content type")
+    {{- end}}
+}
+
+// Validate 校验创建参数 返回所有错误
+func (r CreateRequest) Validate() validate.Errors {
+    v := validate.Validator{}
+    {{- range .CreateParams}}
+    {{- $a := .}}
+    {{- with .Validate}}
+    if r.{{$a.Name}} != nil {
+        o := *r.{{$a.Name}}
+        {{- range .}}
+        {{.}}
+        {{- end}}
+    }
+    {{- end}}
+    {{- if .File}}
+    if r.{{.Name}}File != nil {
+        {{.FileCheck}}
+    }
+    {{- end}}
+    {{- end}}
+    return v.Errors
+}
+{{- if .CreateFile}}
+
+// Upload 保存上传的文件 并将文件地址写入参数
+func (r *CreateRequest) Upload(s storage.Storage) error {
+    {{- range .CreateParams}}
+    {{- if .File}}
+    if r.{{.Name}}File != nil {
+        u, err := storage.Save(s, r.{{.Name}}File)
+        if err != nil {
+            r.Remove(s)
+            return err
+        }
+        r.{{.Name}} = &u
+        r.uploaded = append(r.uploaded, u)
+    }
+    {{- end}}
+    {{- end}}
+    return nil
+}
+
+// Remove 删除 Upload 保存的文件 事务未提交时调用
+func (r *CreateRequest) Remove(s storage.Storage) error {
+    us := r.uploaded
+    r.uploaded = nil
+    return storage.Remove(s, us...)
 }
+{{- end}}
 
+// ApplyTo 将参数写入模型 只写入请求中存在的参数
+func (r CreateRequest) ApplyTo(obj *{{.Model}}) {
+    {{- range .CreateParams}}
+    {{- if ne .CtxFunc "-"}}
+    {{- if eq .NullKind "sql"}}
+    if r.IsNull("{{.JSON}}") {
+        obj.{{.Name}} = {{.GoType}}{}
+    } else if r.{{.Name}} != nil {
+        obj.{{.Name}} = {{.GoType}}{ {{.NullField}}: *r.{{.Name}}, Valid: true}
+    }
+    {{- else if eq .NullKind "ptr"}}
+    if r.IsNull("{{.JSON}}") {
+        obj.{{.Name}} = nil
+    } else if r.{{.Name}} != nil {
+        obj.{{.Name}} = r.{{.Name}}
+    }
+    {{- else}}
+    if r.{{.Name}} != nil {
+        obj.{{.Name}} = *r.{{.Name}}
+    }
+    {{- end}}
+    {{- end}}
+    {{- end}}
+}
+{{end}}
 {{if .Create}}
 // @Summary 创建{{.Desc}}
 // @Description {{.PackageName}}.create
+{{- range .Description}}
+// @Description {{.}}
+{{- end}}
 // @ID {{.PackageName}}.create
-// @Tags {{.PackageName}} {{.Desc}}
+// @Tags {{.PackageName}} {{.Tag}}
 {{- range .CreateSecurity}}
 // @Security {{.}}
 {{- end}}
+{{- if .CreateJSON}}
+// @Accept  json
+{{- end}}
+{{- if .CreateForm}}
 // @Accept  x-www-form-urlencoded
+{{- end}}
+{{- if .CreateFile}}
+// @Accept  multipart/form-data
+{{- end}}
 // @Produce json
+{{- if .CreateForm}}
+{{- if .CreateJSON}}
+// @Description 也可以使用 application/json 请求体 CreateRequest
+{{- end}}
 {{- range .CreateParamsDecs}} 
 {{.}} 
 {{- end}}
-// @Success    200            {object}   models.{{.Name}}
+{{- else}}
+// @Param      body           body       CreateRequest    true   "参数"
+{{- end}}
+// @Success    200            {object}   {{.Model}}
 // @Resource /{{.PackageName}}
 // @Router /{{.PackageName}}    [POST]
 func Create(ctx *ctx.Context) global.RespModel{
 
-    obj := models.{{.Name}}{}
+    req, err := BindCreateRequest(ctx)
+    if err != nil {
+        return global.Resp(global.CodeErrParam, err.Error())
+    }
+    if errs := req.Validate(); len(errs) > 0 {
+        return global.Resp(global.CodeErrParam, errs)
+    }
 
-    {{range .CreateBefore}}
-    if err := models.{{.Name}}(ctx,ctx.DB(),&obj); err != nil {
+    obj := {{.Model}}{}
+    if ok, resp := create(ctx, req, &obj); !ok {
+        return resp
+    }
+    if err := createAfter(ctx, &obj); err != nil {
         return global.Resp(global.CodeErrHandle,err.Error())
     }
-    {{end}}
+    return global.Resp(global.CodeOK, obj)
+}
 
-    {{range .CreateParams}}
-    {{if ne .CtxFunc "-"}}
-    {{if eq .CtxFunc "@"}}
-    if o,ok:=ctx.Getv("{{.JSON}}");ok{
-        obj.{{.Name}} = o.({{.IToM}})
-    }
-    {{else}}
-    if o,ok:=ctx.Get{{.CtxFunc}}v("{{.JSON}}");ok{
-        obj.{{.Name}} = o
+// create 执行创建 Create 与 Upsert 共用 返回是否已提交
+func create(ctx *ctx.Context, req CreateRequest, obj *{{.Model}}) (bool, global.RespModel) {
+
+
+    {{range .CreateBefore}}
+    if err := models.{{.Name}}(ctx,ctx.DB(),obj); err != nil {
+        return false, global.Resp(global.CodeErrHandle,err.Error())
     }
     {{end}}
+
+    {{if .CreateFile}}
+    if err := req.Upload(storage.Default); err != nil {
+        return false, global.Resp(global.CodeErrHandle, err.Error())
+    }
+    // 事务未提交时删除已保存的文件
+    committed := false
+    defer func() {
+        if !committed {
+            req.Remove(storage.Default)
+        }
+    }()
     {{end}}
-    {{end}}
+    req.ApplyTo(obj)
 
     tx, err := sqldb.NewTx(ctx.DB())
 	if err != nil {
-        return global.Resp(global.CodeErrDB,err.Error())
+        return false, global.Resp(global.CodeErrDB,err.Error())
 	}
 	defer tx.End()
 
     {{range .CreateTxBefore}}
-    if err := models.{{.Name}}(ctx,tx.DB(),&obj); err != nil {
-        return global.Resp(global.CodeErrHandle,err.Error())
+    if err := models.{{.Name}}(ctx,tx.DB(),obj); err != nil {
+        return false, global.Resp(global.CodeErrHandle,err.Error())
     }
     {{end}}
 
     {{if .CreateSave}}
-	if err := tx.DB().Create(&obj).Error; err != nil {
-        return global.Resp(global.CodeErrDB,err.Error())
+	if err := tx.DB().Create(obj).Error; err != nil {
+        return false, global.Resp(global.CodeErrDB,err.Error())
 	}
     {{end}}
 
     {{range .CreateTxAfter}}
-    if err := models.{{.Name}}(ctx,tx.DB(),&obj); err != nil {
-        return global.Resp(global.CodeErrHandle,err.Error())
+    if err := models.{{.Name}}(ctx,tx.DB(),obj); err != nil {
+        return false, global.Resp(global.CodeErrHandle,err.Error())
     }
     {{end}}
 
 	if err := tx.Commit(); err != nil {
-        return global.Resp(global.CodeErrDB,err.Error())
+        return false, global.Resp(global.CodeErrDB,err.Error())
 	}
+    {{- if .CreateFile}}
+    committed = true
+    {{- end}}
+    return true, global.Resp(global.CodeOK, obj)
+}
 
+// createAfter 执行提交后的 Func
+func createAfter(ctx *ctx.Context, obj *{{.Model}}) error {
     {{range .CreateAfter}}
-    if err := models.{{.Name}}(ctx,ctx.DB(),&obj); err != nil {
-        return global.Resp(global.CodeErrHandle,err.Error())
+    if err := models.{{.Name}}(ctx,ctx.DB(),obj); err != nil {
+        return err
     }
     {{end}}
-    return global.Resp(global.CodeOK, obj)
+    return nil
+}
+{{end}}
+{{if .Update}}
+// UpdateRequest 更新{{.Desc}}参数 未提供的参数为nil
+type UpdateRequest struct {
+    {{- range .UpdateParams}}
+    {{- if ne .CtxFunc "-"}}
+    // {{.Desc}}
+    {{- if .File}}
+    {{.Name}} *{{.ReqType}} ` + "`json:\"-\"`" + `
+    {{.Name}}File *multipart.FileHeader ` + "`json:\"-\"`" + `
+    {{- else}}
+    {{.Name}} *{{.ReqType}} ` + "`json:\"{{.JSON}},omitempty\"`" + `
+    {{- end}}
+    {{- end}}
+    {{- end}}
+    {{- if .UpdateNullable}}
+    // 显式设置为 null 的参数
+    Null []string ` + "`json:\"-\"`" + `
+    {{- end}}
+    {{- if .UpdateFile}}
+    // 已保存的文件地址
+    uploaded []string
+    {{- end}}
+}
+{{- if .UpdateNullable}}
+
+// IsNull 参数是否显式设置为 null
+func (r UpdateRequest) IsNull(key string) bool {
+    for _, v := range r.Null {
+        if v == key {
+            return true
+        }
+    }
+    return false
+}
+{{- end}}
+
+{{- if .UpdateTime}}
+
+// UnmarshalJSON json 请求体中的时间参数与表单相同 按 timeformat timezone 解析
+func (r *UpdateRequest) UnmarshalJSON(data []byte) error {
+    type plain UpdateRequest
+    p := struct {
+        *plain
+        {{- range .UpdateParams}}
+        {{- if eq .Encoding "time"}}
+        {{.Name}} json.RawMessage ` + "`json:\"{{.JSON}}\"`" + `
+        {{- end}}
+        {{- end}}
+    }{plain: (*plain)(r)}
+    if err := json.Unmarshal(data, &p); err != nil {
+        return err
+    }
+    {{- range .UpdateParams}}
+    {{- if eq .Encoding "time"}}
+    if err := bind.RawTime(p.{{.Name}}, "{{.JSON}}", {{printf "%q" .TimeFormat}}, {{printf "%q" .TimeZone}}, &r.{{.Name}}); err != nil {
+        return err
+    }
+    {{- end}}
+    {{- end}}
+    return nil
+}
+{{- end}}
+
+// BindUpdateRequest 读取更新参数
+func BindUpdateRequest(ctx *ctx.Context) (UpdateRequest, error) {
+    r := UpdateRequest{}
+    {{- if .UpdateJSON}}
+    if strings.HasPrefix(ctx.Request().Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+        {{- if .UpdateNullable}}
+        data, err := ioutil.ReadAll(ctx.Request().Body)
+        if err != nil {
+            return r, err
+        }
+        if err := json.Unmarshal(data, &r); err != nil {
+            return r, err
+        }
+        r.Null = bind.Nulls(data{{range .UpdateParams}}{{if .NullKind}}, "{{.JSON}}"{{end}}{{end}})
+        return r, nil
+        {{- else}}
+        err := json.NewDecoder(ctx.Request().Body).Decode(&r)
+        return r, err
+        {{- end}}
+    }
+    {{- end}}
+    {{- if .UpdateForm}}
+    {{- if .UpdateEncoded}}
+    form, err := ctx.FormParams()
+    if err != nil {
+        return r, err
+    }
+    {{- end}}
+    {{- range .UpdateParams}}
+    {{- if ne .CtxFunc "-"}}
+    {{- if .Null}}
+    if bind.Null(form, "{{.JSON}}") {
+        r.Null = append(r.Null, "{{.JSON}}")
+    }
+    {{- end}}
+    {{- if .File}}
+    // 文件地址只能通过上传设置
+    if fh, err := ctx.FormFile("{{.JSON}}"); err == nil {
+        r.{{.Name}}File = fh
+    }
+    {{- else if eq .Encoding "json"}}
+    if err := bind.JSON(form, "{{.JSON}}", &r.{{.Name}}); err != nil {
+        return r, err
+    }
+    {{- else if eq .Encoding "time"}}
+    if err := bind.Time(form, "{{.JSON}}", {{printf "%q" .TimeFormat}}, {{printf "%q" .TimeZone}}, &r.{{.Name}}); err != nil {
+        return r, err
+    }
+    {{- else if .Encoding}}
+    if err := bind.Slice(form, "{{.JSON}}", "{{.Encoding}}", &r.{{.Name}}); err != nil {
+        return r, err
+    }
+    {{- else if eq .CtxFunc "@"}}
+    if o,ok:=ctx.Getv("{{.JSON}}");ok{
+        v := o.({{.IToM}})
+        r.{{.Name}} = &v
+    }
+    {{- else}}
+    if o,ok:=ctx.Get{{.CtxFunc}}v("{{.JSON}}");ok{{if .Null}}&&!r.IsNull("{{.JSON}}"){{end}}{
+        v := {{.ReqType}}(o)
+        r.{{.Name}} = &v
+    }
+    {{- end}}
+    {{- end}}
+    {{- end}}
+    return r, nil
+    {{- else}}
+    return r, errors.New("unsupported content type")
+    {{- end}}
+}
+
+// Validate 校验更新参数 返回所有错误
+func (r UpdateRequest) Validate() validate.Errors {
+    v := validate.Validator{}
+    {{- range .UpdateParams}}
+    {{- $a := .}}
+    {{- with .Validate}}
+    if r.{{$a.Name}} != nil {
+        o := *r.{{$a.Name}}
+        {{- range .}}
+        {{.}}
+        {{- end}}
+    }
+    {{- end}}
+    {{- if .File}}
+    if r.{{.Name}}File != nil {
+        {{.FileCheck}}
+    }
+    {{- end}}
+    {{- end}}
+    return v.Errors
+}
+{{- if .UpdateFile}}
+
+// Upload 保存上传的文件 并将文件地址写入参数
+func (r *UpdateRequest) Upload(s storage.Storage) error {
+    {{- range .UpdateParams}}
+    {{- if .File}}
+    if r.{{.Name}}File != nil {
+        u, err := storage.Save(s, r.{{.Name}}File)
+        if err != nil {
+            r.Remove(s)
+            return err
+        }
+        r.{{.Name}} = &u
+        r.uploaded = append(r.uploaded, u)
+    }
+    {{- end}}
+    {{- end}}
+    return nil
+}
+
+// Remove 删除 Upload 保存的文件 事务未提交时调用
+func (r *UpdateRequest) Remove(s storage.Storage) error {
+    us := r.uploaded
+    r.uploaded = nil
+    return storage.Remove(s, us...)
+}
+{{- end}}
+
+// ApplyTo 将参数写入模型 只写入请求中存在的参数
+func (r UpdateRequest) ApplyTo(obj *{{.Model}}) {
+    {{- range .UpdateParams}}
+    {{- if ne .CtxFunc "-"}}
+    {{- if eq .NullKind "sql"}}
+    if r.IsNull("{{.JSON}}") {
+        obj.{{.Name}} = {{.GoType}}{}
+    } else if r.{{.Name}} != nil {
+        obj.{{.Name}} = {{.GoType}}{ {{.NullField}}: *r.{{.Name}}, Valid: true}
+    }
+    {{- else if eq .NullKind "ptr"}}
+    if r.IsNull("{{.JSON}}") {
+        obj.{{.Name}} = nil
+    } else if r.{{.Name}} != nil {
+        obj.{{.Name}} = r.{{.Name}}
+    }
+    {{- else}}
+    if r.{{.Name}} != nil {
+        obj.{{.Name}} = *r.{{.Name}}
+    }
+    {{- end}}
+    {{- end}}
+    {{- end}}
+}
+{{- if .UpdatePatch}}
+
+// Changed 请求中存在的参数对应的字段名
+func (r UpdateRequest) Changed() []string {
+    fs := []string{}
+    {{- range .UpdateParams}}
+    {{- if ne .CtxFunc "-"}}
+    if r.{{.Name}} != nil{{if .File}} || r.{{.Name}}File != nil{{end}}{{if .NullKind}} || r.IsNull("{{.JSON}}"){{end}} {
+        fs = append(fs, "{{.Name}}")
+    }
+    {{- end}}
+    {{- end}}
+    return fs
+}
+
+// Columns 字段对应的更新值
+func (r UpdateRequest) Columns(obj *{{.Model}}, fields []string) map[string]interface{} {
+    m := map[string]interface{}{}
+    for _, f := range fields {
+        switch f {
+        {{- range .UpdateParams}}
+        {{- if ne .CtxFunc "-"}}
+        case "{{.Name}}":
+            m[f] = obj.{{.Name}}
+        {{- end}}
+        {{- end}}
+        }
+    }
+    return m
 }
+{{- end}}
 {{end}}
 {{if .Update}}
 // @Summary 更新{{.Desc}}
 // @Description {{.PackageName}}.update
+{{- range .Description}}
+// @Description {{.}}
+{{- end}}
 // @ID {{.PackageName}}.update
-// @Tags {{.PackageName}} {{.Desc}}
+// @Tags {{.PackageName}} {{.Tag}}
 {{- range .UpdateSecurity}}
 // @Security {{.}}
 {{- end}}
+{{- if .UpdateJSON}}
+// @Accept  json
+{{- end}}
+{{- if .UpdateForm}}
 // @Accept  x-www-form-urlencoded
+{{- end}}
+{{- if .UpdateFile}}
+// @Accept  multipart/form-data
+{{- end}}
 // @Produce json
-// @Param      id             path       string           true   "id"
+{{- range .Keys}}
+// @Param      {{.Param}}  path  {{.Type}}  true  "{{.Column}}"
+{{- end}}
+{{- if .Optimistic}}
+// @Param      {{.VersionJSON}}  query  integer  false  "版本号 也可以使用 If-Match"
+{{- end}}
+{{- if .UpdateForm}}
+{{- if .UpdateJSON}}
+// @Description 也可以使用 application/json 请求体 UpdateRequest
+{{- end}}
 {{- range .UpdateParamsDecs}} 
 {{.}} 
 {{- end}}
-// @Success    200            {object}   models.{{.Name}}
+{{- else}}
+// @Param      body           body       UpdateRequest    true   "参数"
+{{- end}}
+// @Success    200            {object}   {{.Model}}
 // @Resource /{{.PackageName}}
-// @Router /{{.PackageName}}/{id}    [POST]
+// @Router /{{.PackageName}}{{.KeyPath}}    [POST]
 func Update(ctx *ctx.Context) global.RespModel {
+    keys, err := ParseKeys(ctx)
+    if err != nil {
+        return global.Resp(global.CodeErrParam, err.Error())
+    }
+    if len(keys) != 1 {
+        return global.Resp(global.CodeErrParam, "{{(index .Keys 0).Param}}")
+    }
 
-    obj := models.{{.Name}}{}
+    req, err := BindUpdateRequest(ctx)
+    if err != nil {
+        return global.Resp(global.CodeErrParam, err.Error())
+    }
+    if errs := req.Validate(); len(errs) > 0 {
+        return global.Resp(global.CodeErrParam, errs)
+    }
 
-    {{range .UpdateBefore}}
-    if err := models.{{.Name}}(ctx,ctx.DB(),&obj); err != nil {
+    obj := {{.Model}}{}
+    if ok, resp := update(ctx, keys, req, &obj); !ok {
+        return resp
+    }
+    if err := updateAfter(ctx, &obj); err != nil {
         return global.Resp(global.CodeErrHandle,err.Error())
     }
+    return global.Resp(global.CodeOK, obj)
+}
+
+{{- if .UpdateSave}}
+// saveColumns 全量更新的列 与 gorm Save 相同 不包含 gorm 主键
+func saveColumns(db *gorm.DB, obj *{{.Model}}) map[string]interface{} {
+    m := map[string]interface{}{}
+    for _, f := range db.NewScope(obj).Fields() {
+        if f.IsNormal && !f.IsIgnored && !f.IsPrimaryKey && (f.Name != "CreatedAt" || !f.IsBlank) {
+            m[f.DBName] = f.Field.Interface()
+        }
+    }
+    return m
+}
+{{- end}}
+
+// update 执行更新 Update 与 Upsert 共用 返回是否已提交
+func update(ctx *ctx.Context, keys []Key, req UpdateRequest, obj *{{.Model}}) (bool, global.RespModel) {
+    {{- if .Optimistic}}
+    vs := ctx.Request().Header.Get("If-Match")
+    if o, ok := ctx.GetStringv("{{.VersionJSON}}"); ok {
+        vs = o
+    }
+    versions, err := bind.Versions(vs)
+    if err != nil || len(versions) != 1 {
+        return false, global.Resp(global.CodeErrParam, "{{.VersionJSON}}")
+    }
+    {{- end}}
+    {{- if .UpdatePatch}}
+    changed := req.Changed()
+    ctx.Set(bind.ChangedKey, changed)
+    {{- end}}
+
+
+    {{range .UpdateBefore}}
+    if err := models.{{.Name}}(ctx,ctx.DB(),obj); err != nil {
+        return false, global.Resp(global.CodeErrHandle,err.Error())
+    }
     {{end}}
 
+    {{if .UpdateLock}}
+    tx, err := sqldb.NewTx(ctx.DB())
+	if err != nil {
+        return false, global.Resp(global.CodeErrDB,err.Error())
+	}
+	defer tx.End()
 
-	if err := ctx.DB().Where("{{.DBIndex}} = ?", ctx.ID()).First(&obj).Error; err != nil {
+	if err := WhereKeys(lock.For(tx.DB(), "{{.UpdateLock}}"), keys).First(obj).Error; err != nil {
+    {{- else}}
+	if err := WhereKeys(ctx.DB(), keys).First(obj).Error; err != nil {
+    {{- end}}
         if err == gorm.ErrRecordNotFound{
-            return global.Resp(global.CodeErrNotFound,err.Error())
+            return false, global.Resp(global.CodeErrNotFound,err.Error())
         }
-        return global.Resp(global.CodeErrDB,err.Error())
+        return false, global.Resp(global.CodeErrDB,err.Error())
 	}
+    {{- if .Optimistic}}
+    if int64(obj.{{.Version}}) != versions[0] {
+        return false, global.Resp(global.CodeErrConflict, "{{.VersionJSON}}")
+    }
+    {{- end}}
 
 
-    {{range .UpdateParams}}
-    {{if ne .CtxFunc "-"}}
-    {{if eq .CtxFunc "@"}}
-    if o,ok:=ctx.Getv("{{.JSON}}");ok{
-        obj.{{.Name}} = o.({{.IToM}})
+    {{if .UpdateFile}}
+    if err := req.Upload(storage.Default); err != nil {
+        return false, global.Resp(global.CodeErrHandle, err.Error())
     }
-    {{else}}
-    if o,ok:=ctx.Get{{.CtxFunc}}v("{{.JSON}}");ok{
-        obj.{{.Name}} = o
-    }
-    {{end}}
-    {{end}}
+    // 事务未提交时删除已保存的文件
+    committed := false
+    defer func() {
+        if !committed {
+            req.Remove(storage.Default)
+        }
+    }()
     {{end}}
+    req.ApplyTo(obj)
 
+    {{if not .UpdateLock}}
     tx, err := sqldb.NewTx(ctx.DB())
 	if err != nil {
-        return global.Resp(global.CodeErrDB,err.Error())
+        return false, global.Resp(global.CodeErrDB,err.Error())
 	}
 	defer tx.End()
+    {{end}}
+    {{- if .Optimistic}}
+
+    // 版本号一致时才更新 并发的请求在此等待行锁
+    if res := WhereKeys(tx.DB().Model(new({{.Model}})), keys).Where("{{.VersionColumn}} = ?", versions[0]).UpdateColumn("{{.VersionColumn}}", gorm.Expr("{{.VersionColumn}} + 1")); res.Error != nil {
+        return false, global.Resp(global.CodeErrDB,res.Error.Error())
+    } else if res.RowsAffected == 0 {
+        return false, global.Resp(global.CodeErrConflict, "{{.VersionJSON}}")
+    }
+    obj.{{.Version}}++
+    {{- end}}
 
     {{range .UpdateTxBefore}}
-    if err := models.{{.Name}}(ctx,tx.DB(),&obj); err != nil {
-        return global.Resp(global.CodeErrHandle,err.Error())
+    if err := models.{{.Name}}(ctx,tx.DB(),obj); err != nil {
+        return false, global.Resp(global.CodeErrHandle,err.Error())
     }
     {{end}}
     
 
     {{if .UpdateSave}}
-	if err := tx.DB().Save(&obj).Error; err != nil {
-        return global.Resp(global.CodeErrDB,err.Error())
+    {{- if .UpdatePatch}}
+    if len(changed) > 0 {
+        // 按主键更新 主键不是 gorm 主键时 gorm 不会添加条件
+        if err := WhereKeys(tx.DB().Model(obj), keys).Updates(req.Columns(obj, changed)).Error; err != nil {
+            return false, global.Resp(global.CodeErrDB,err.Error())
+        }
+    }
+    {{- else}}
+    // 按主键更新 Save 在 gorm 主键为空时会插入新数据
+	if err := WhereKeys(tx.DB().Model(obj), keys).Updates(saveColumns(tx.DB(), obj)).Error; err != nil {
+        return false, global.Resp(global.CodeErrDB,err.Error())
 	}
+    {{- end}}
     {{end}}
 
     {{range .UpdateTxAfter}}
-    if err := models.{{.Name}}(ctx,tx.DB(),&obj); err != nil {
-        return global.Resp(global.CodeErrHandle,err.Error())
+    if err := models.{{.Name}}(ctx,tx.DB(),obj); err != nil {
+        return false, global.Resp(global.CodeErrHandle,err.Error())
     }
     {{end}}
 
 	if err := tx.Commit(); err != nil {
-        return global.Resp(global.CodeErrDB,err.Error())
+        return false, global.Resp(global.CodeErrDB,err.Error())
 	}
+    {{- if .UpdateFile}}
+    committed = true
+    {{- end}}
+    return true, global.Resp(global.CodeOK, obj)
+}
 
+// updateAfter 执行提交后的 Func
+func updateAfter(ctx *ctx.Context, obj *{{.Model}}) error {
     {{range .UpdateAfter}}
-    if err := models.{{.Name}}(ctx,ctx.DB(),&obj); err != nil {
-        return global.Resp(global.CodeErrHandle,err.Error())
+    if err := models.{{.Name}}(ctx,ctx.DB(),obj); err != nil {
+        return err
     }
     {{end}}
-    return global.Resp(global.CodeOK,obj)
+    return nil
 }
 {{end}}
-{{if .List}}
-// @Summary {{.Desc}}列表
-// @Description {{.PackageName}}.list
-// @ID {{.PackageName}}.list
-// @Tags {{.PackageName}} {{.Desc}}
-{{- range .ListSecurity}}
+{{if .UpdateFilter}}
+// @Summary 按条件更新{{.Desc}}
+// @Description {{.PackageName}}.update_filter
+// @Description 条件与列表相同 参数与 {{.PackageName}}.update 相同 匹配的数据使用相同的参数在同一个事务中更新
+// @Description 最多更新 {{.UpdateFilterMax}} 条 超过时不更新并返回错误
+// @ID {{.PackageName}}.update_filter
+// @Tags {{.PackageName}} {{.Tag}}
+{{- range .UpdateFilterSecurity}}
 // @Security {{.}}
 {{- end}}
+{{- if .UpdateJSON}}
+// @Accept  json
+{{- end}}
+{{- if .UpdateForm}}
+// @Accept  x-www-form-urlencoded
+{{- end}}
+{{- if .UpdateFile}}
+// @Accept  multipart/form-data
+{{- end}}
 // @Produce json
-// @Param        skip         query        integer        false "间隔"  mininum(0)
-// @Param        limit        query        integer        false "条数"  mininum(0) maxinum(100)  default(20)
-// @Param        sort         query        string         false "排序"
-// @Param        fields       query        string         true  "请求字段"
-// @Param        filters      query        string         false "过滤条件"
-// @Success      200          {object}     models.{{.Name}}
-// @Resource /{{.PackageName}}
-// @Router /{{.PackageName}}       [get]
-func List(ctx *ctx.Context) global.RespModel {
-    objs := []models.{{.Name}}{}
-
-    {{range .ListBefore}}
-    if err := models.{{.Name}}(ctx,ctx.DB(),&objs); err != nil {
-        return global.Resp(global.CodeErrHandle,err.Error())
+// @Param        filters      query        string         true  "过滤条件"
+// @Param        dry_run      query        boolean        false "只返回匹配的条数"
+{{- if .UpdateForm}}
+{{- range .UpdateParamsDecs}} 
+{{.}} 
+{{- end}}
+{{- else}}
+// @Param      body           body       UpdateRequest    true   "参数"
+{{- end}}
+// @Success      200          {integer}    integer        "更新的条数"
+// @Resource     /{{.PackageName}}
+// @Router       /{{.PackageName}} [PATCH]
+func UpdateFilter(ctx *ctx.Context) global.RespModel {
+    filters := ctx.GetFilters()
+    if filters == "" {
+        return global.Resp(global.CodeErrParam, "filters")
     }
-    {{end}}
+    dryRun, _ := ctx.GetBoolv("dry_run")
 
-    fields := utils.FiltersToMap(ctx.GetFields())
+    req, err := BindUpdateRequest(ctx)
+    if err != nil {
+        return global.Resp(global.CodeErrParam, err.Error())
+    }
+    if errs := req.Validate(); len(errs) > 0 {
+        return global.Resp(global.CodeErrParam, errs)
+    }
+    {{- if .UpdatePatch}}
+    changed := req.Changed()
+    ctx.Set(bind.ChangedKey, changed)
+    {{- end}}
 
-    {{if .ListPreload}}
-	total, err := sqldb.FindWithJson(sqldb.Preload(ctx.DB(),fields,map[string]interface{}{
-        {{- range .ListPreloadV}}
-        "{{.}}",
-        {{end}}
-    }), new(models.{{.Name}}), &objs, ctx.GetFilters(), ctx.GetSort(), ctx.GetSkip(), ctx.GetLimit(), true)
-    {{else}}
-	total, err := sqldb.FindWithJson(ctx.DB(), new(models.{{.Name}}), &objs, ctx.GetFilters(), ctx.GetSort(), ctx.GetSkip(), ctx.GetLimit(), true)
-    {{end}}
+    tx, err := sqldb.NewTx(ctx.DB())
 	if err != nil {
-            return global.Resp(global.CodeErrDB,err.Error())
+        return global.Resp(global.CodeErrDB,err.Error())
+	}
+	defer tx.End()
+
+    objs := []{{.Model}}{}
+    {{- if .ListBefore}}
+    // 与列表相同的 ListBefore
+    {{- range .ListBefore}}
+    if err := models.{{.Name}}(ctx,tx.DB(),&objs); err != nil {
+        return global.Resp(global.CodeErrHandle,err.Error())
+    }
+    {{- end}}
+    filters = ctx.GetFilters()
+    {{- end}}
+    // 多读取一条判断是否超过上限
+    if _, err := sqldb.FindWithJson({{if .UpdateLock}}lock.For(tx.DB(), "{{.UpdateLock}}"){{else}}tx.DB(){{end}}, new({{.Model}}), &objs, filters, "", 0, {{.UpdateFilterMax}}+1, false); err != nil {
+        return global.Resp(global.CodeErrDB, err.Error())
+    }
+    if len(objs) > {{.UpdateFilterMax}} {
+        return global.Resp(global.CodeErrParam, "too many rows, max {{.UpdateFilterMax}}")
+    }
+    if dryRun || len(objs) == 0 {
+        return global.Resp(global.CodeOK, len(objs))
+    }
+
+    // Func 通过 bind.IDs(ctx) 获取本次更新的全部主键
+    ids := make([]string, len(objs))
+    for i, obj := range objs {
+        ids[i] = {{range $i, $k := .Keys}}{{if $i}} + "/" + {{end}}fmt.Sprint(obj.{{.Name}}){{end}}
+    }
+    ctx.Set(bind.IDsKey, ids)
+
+    {{- if .UpdateFile}}
+
+    if err := req.Upload(storage.Default); err != nil {
+        return global.Resp(global.CodeErrHandle, err.Error())
+    }
+    // 事务未提交时删除已保存的文件
+    committed := false
+    defer func() {
+        if !committed {
+            req.Remove(storage.Default)
+        }
+    }()
+    {{- end}}
+
+    for i := range objs {
+        obj := &objs[i]
+        {{- if .Optimistic}}
+        version := obj.{{.Version}}
+        {{- end}}
+        {{- range .UpdateBefore}}
+        if err := models.{{.Name}}(ctx,ctx.DB(),obj); err != nil {
+            return global.Resp(global.CodeErrHandle,err.Error())
+        }
+        {{- end}}
+
+        req.ApplyTo(obj)
+        {{- if or .Optimistic .UpdateSave}}
+        keys := []Key{ { {{- range $i, $k := .Keys}}{{if $i}}, {{end}}{{.Name}}: obj.{{.Name}}{{end -}} } }
+        {{- end}}
+        {{- if .Optimistic}}
+
+        // 读取后被其他请求修改时返回冲突
+        if res := WhereKeys(tx.DB().Model(new({{.Model}})), keys).Where("{{.VersionColumn}} = ?", version).UpdateColumn("{{.VersionColumn}}", gorm.Expr("{{.VersionColumn}} + 1")); res.Error != nil {
+            return global.Resp(global.CodeErrDB,res.Error.Error())
+        } else if res.RowsAffected == 0 {
+            return global.Resp(global.CodeErrConflict, ids[i])
+        }
+        obj.{{.Version}}++
+        {{- end}}
+
+        {{- range .UpdateTxBefore}}
+        if err := models.{{.Name}}(ctx,tx.DB(),obj); err != nil {
+            return global.Resp(global.CodeErrHandle,err.Error())
+        }
+        {{- end}}
+
+        {{- if .UpdateSave}}
+        {{- if .UpdatePatch}}
+        if len(changed) > 0 {
+            if err := WhereKeys(tx.DB().Model(obj), keys).Updates(req.Columns(obj, changed)).Error; err != nil {
+                return global.Resp(global.CodeErrDB,err.Error())
+            }
+        }
+        {{- else}}
+        if err := WhereKeys(tx.DB().Model(obj), keys).Updates(saveColumns(tx.DB(), obj)).Error; err != nil {
+            return global.Resp(global.CodeErrDB,err.Error())
+        }
+        {{- end}}
+        {{- end}}
+
+        {{- range .UpdateTxAfter}}
+        if err := models.{{.Name}}(ctx,tx.DB(),obj); err != nil {
+            return global.Resp(global.CodeErrHandle,err.Error())
+        }
+        {{- end}}
+    }
+
+	if err := tx.Commit(); err != nil {
+        return global.Resp(global.CodeErrDB,err.Error())
+	}
+    {{- if .UpdateFile}}
+    committed = true
+    {{- end}}
+    {{- if .UpdateAfter}}
+
+    for i := range objs {
+        {{- range .UpdateAfter}}
+        if err := models.{{.Name}}(ctx,ctx.DB(),&objs[i]); err != nil {
+            return global.Resp(global.CodeErrHandle,err.Error())
+        }
+        {{- end}}
+    }
+    {{- end}}
+    return global.Resp(global.CodeOK, len(objs))
+}
+{{end}}
+{{if .DeleteFilter}}
+// @Summary 按条件删除{{.Desc}}
+// @Description {{.PackageName}}.delete_filter
+// @Description 条件与列表相同 最多删除 {{.DeleteFilterMax}} 条 超过时不删除并返回错误
+// @ID {{.PackageName}}.delete_filter
+// @Tags {{.PackageName}} {{.Tag}}
+{{- range .DeleteFilterSecurity}}
+// @Security {{.}}
+{{- end}}
+// @Produce json
+// @Param        filters      query        string         true  "过滤条件"
+// @Param        confirm      query        boolean        false "确认删除 不是 dry_run 时必须为 true"
+// @Param        dry_run      query        boolean        false "只返回将要删除的数据"
+// @Param        fields       query        string         false "dry_run 时的请求字段"
+// @Success      200          {integer}    integer        "删除的条数"
+// @Resource     /{{.PackageName}}
+// @Router       /{{.PackageName}} [DELETE]
+func DeleteFilter(ctx *ctx.Context) global.RespModel {
+    filters := ctx.GetFilters()
+    if filters == "" {
+        return global.Resp(global.CodeErrParam, "filters")
+    }
+    dryRun, _ := ctx.GetBoolv("dry_run")
+    if confirm, _ := ctx.GetBoolv("confirm"); !confirm && !dryRun {
+        return global.Resp(global.CodeErrParam, "confirm")
+    }
+
+	tx, err := sqldb.NewTx(ctx.DB())
+	if err != nil {
+        return global.Resp(global.CodeErrDB,err.Error())
+	}
+	defer tx.End()
+
+    objs := []{{.Model}}{}
+    {{- if .ListBefore}}
+    // 与列表相同的 ListBefore
+    {{- range .ListBefore}}
+    if err := models.{{.Name}}(ctx,tx.DB(),&objs); err != nil {
+        return global.Resp(global.CodeErrHandle,err.Error())
+    }
+    {{- end}}
+    filters = ctx.GetFilters()
+    {{- end}}
+    // 多读取一条判断是否超过上限
+    if _, err := sqldb.FindWithJson({{if .DeleteLock}}lock.For(tx.DB(), "{{.DeleteLock}}"){{else}}tx.DB(){{end}}, new({{.Model}}), &objs, filters, "", 0, {{.DeleteFilterMax}}+1, false); err != nil {
+        return global.Resp(global.CodeErrDB, err.Error())
+    }
+    if len(objs) > {{.DeleteFilterMax}} {
+        return global.Resp(global.CodeErrParam, "too many rows, max {{.DeleteFilterMax}}")
+    }
+    if dryRun {
+        fields := utils.FiltersToMap(ctx.GetFields())
+        return global.RespsWithFileds(global.CodeOK, int64(len(objs)), objs, ctx.AppKey, fields)
+    }
+    if len(objs) == 0 {
+        return global.Resp(global.CodeOK, 0)
+    }
+
+    keys := make([]Key, len(objs))
+    {{- if eq (len .Keys) 1}}
+    ids := make([]string, len(objs))
+    {{- end}}
+    {{- if .Optimistic}}
+    // 读取时的版本号 删除前被修改时返回冲突
+    versions := make([]int64, len(objs))
+    {{- end}}
+    for i, obj := range objs {
+        keys[i] = Key{ {{- range $i, $k := .Keys}}{{if $i}}, {{end}}{{.Name}}: obj.{{.Name}}{{end -}} }
+        {{- if eq (len .Keys) 1}}
+        ids[i] = fmt.Sprint(obj.{{(index .Keys 0).Name}})
+        {{- end}}
+        {{- if .Optimistic}}
+        versions[i] = int64(obj.{{.Version}})
+        {{- end}}
+    }
+
+    {{- range .DeleteBefore}}
+    if err := models.{{.Name}}(ctx,ctx.DB(),{{if eq (len $.Keys) 1}}ids{{else}}keys{{end}}); err != nil {
+        return global.Resp(global.CodeErrHandle,err.Error())
+    }
+    {{- end}}
+    if ok, resp := deleteTx(ctx, tx.DB(), keys, {{if eq (len .Keys) 1}}ids{{else}}keys{{end}}{{if .Optimistic}}, versions{{end}}); !ok {
+        return resp
+    }
+	if err := tx.Commit(); err != nil {
+        return global.Resp(global.CodeErrDB,err.Error())
+	}
+    {{- range .DeleteAfter}}
+    if err := models.{{.Name}}(ctx,ctx.DB(),{{if eq (len $.Keys) 1}}ids{{else}}keys{{end}}); err != nil {
+        return global.Resp(global.CodeErrHandle,err.Error())
+    }
+    {{- end}}
+    return global.Resp(global.CodeOK, len(keys))
+}
+{{end}}
+{{range .Lookups}}
+// @Summary 按 {{.Key.Column}} 查询{{$.Desc}}详情
+// @Description {{$.PackageName}}.info_by_{{.Key.Param}}
+{{- range $.Description}}
+// @Description {{.}}
+{{- end}}
+// @ID {{$.PackageName}}.info_by_{{.Key.Param}}
+// @Tags {{$.PackageName}} {{$.Tag}}
+{{- range $.InfoSecurity}}
+// @Security {{.}}
+{{- end}}
+// @Produce  json
+// @Param        {{.Key.Param}}  path  {{.Key.Type}}  true  "{{.Key.Column}}"
+// @Param        fields     query        string         true  "请求字段"
+// @Success      200        {object}     {{$.Model}}
+{{- if $.Optimistic}}
+// @Header       200        {string}     ETag  "版本号"
+{{- end}}
+// @Resource /{{$.PackageName}}
+// @Router /{{$.PackageName}}/by-{{.Key.Param}}/{{printf "{%s}" .Key.Param}}     [get]
+func InfoBy{{.Key.Name}}(ctx *ctx.Context) global.RespModel {
+    var value {{.Key.GoType}}
+    if err := bind.Key(ctx.Param("{{.Key.Param}}"), &value); err != nil {
+        return global.Resp(global.CodeErrParam, fmt.Sprintf("{{.Key.Param}}: %s", err))
+    }
+
+    return info(ctx, func(db *gorm.DB) *gorm.DB {
+        return db.Where("{{.Key.Column}} = ?", value)
+    })
+}
+{{if .Update}}
+// @Summary 按 {{.Key.Column}} 更新{{$.Desc}}
+// @Description {{$.PackageName}}.update_by_{{.Key.Param}}
+// @Description 参数与 {{$.PackageName}}.update 相同
+// @ID {{$.PackageName}}.update_by_{{.Key.Param}}
+// @Tags {{$.PackageName}} {{$.Tag}}
+{{- range $.UpdateSecurity}}
+// @Security {{.}}
+{{- end}}
+{{- if $.UpdateJSON}}
+// @Accept  json
+{{- end}}
+{{- if $.UpdateForm}}
+// @Accept  x-www-form-urlencoded
+{{- end}}
+{{- if $.UpdateFile}}
+// @Accept  multipart/form-data
+{{- end}}
+// @Produce json
+// @Param      {{.Key.Param}}  path  {{.Key.Type}}  true  "{{.Key.Column}}"
+{{- if $.Optimistic}}
+// @Param      {{$.VersionJSON}}  query  integer  false  "版本号 也可以使用 If-Match"
+{{- end}}
+{{- if $.UpdateForm}}
+{{- range $.UpdateParamsDecs}} 
+{{.}} 
+{{- end}}
+{{- else}}
+// @Param      body           body       UpdateRequest    true   "参数"
+{{- end}}
+// @Success    200            {object}   {{$.Model}}
+// @Resource /{{$.PackageName}}
+// @Router /{{$.PackageName}}/by-{{.Key.Param}}/{{printf "{%s}" .Key.Param}}    [POST]
+func UpdateBy{{.Key.Name}}(ctx *ctx.Context) global.RespModel {
+    var value {{.Key.GoType}}
+    if err := bind.Key(ctx.Param("{{.Key.Param}}"), &value); err != nil {
+        return global.Resp(global.CodeErrParam, fmt.Sprintf("{{.Key.Param}}: %s", err))
+    }
+
+    obj := {{$.Model}}{}
+    if err := ctx.DB().Where("{{.Key.Column}} = ?", value).First(&obj).Error; err != nil {
+        if err == gorm.ErrRecordNotFound {
+            return global.Resp(global.CodeErrNotFound, err.Error())
+        }
+        return global.Resp(global.CodeErrDB, err.Error())
+    }
+    keys := []Key{ { {{- range $i, $k := $.Keys}}{{if $i}}, {{end}}{{.Name}}: obj.{{.Name}}{{end -}} } }
+
+    req, err := BindUpdateRequest(ctx)
+    if err != nil {
+        return global.Resp(global.CodeErrParam, err.Error())
+    }
+    if errs := req.Validate(); len(errs) > 0 {
+        return global.Resp(global.CodeErrParam, errs)
+    }
+
+    obj = {{$.Model}}{}
+    if ok, resp := update(ctx, keys, req, &obj); !ok {
+        return resp
+    }
+    if err := updateAfter(ctx, &obj); err != nil {
+        return global.Resp(global.CodeErrHandle,err.Error())
+    }
+    return global.Resp(global.CodeOK, obj)
+}
+{{end}}
+{{- if .Delete}}
+// @Summary 按 {{.Key.Column}} 删除{{$.Desc}}
+// @Description {{$.PackageName}}.delete_by_{{.Key.Param}}
+// @ID {{$.PackageName}}.delete_by_{{.Key.Param}}
+// @Tags {{$.PackageName}} {{$.Tag}}
+{{- range $.DeleteSecurity}}
+// @Security {{.}}
+{{- end}}
+// @Accept  x-www-form-urlencoded
+// @Param        {{.Key.Param}}  path  {{.Key.Type}}  true  "{{.Key.Column}}"
+{{- if $.Optimistic}}
+// @Param        {{$.VersionJSON}}  query  integer  false  "版本号 也可以使用 If-Match"
+{{- end}}
+// @Success      200              {string}   string
+// @Resource     /{{$.PackageName}}
+// @Router       /{{$.PackageName}}/by-{{.Key.Param}}/{{printf "{%s}" .Key.Param}} [DELETE]
+func DeleteBy{{.Key.Name}}(ctx *ctx.Context) global.RespModel {
+    var value {{.Key.GoType}}
+    if err := bind.Key(ctx.Param("{{.Key.Param}}"), &value); err != nil {
+        return global.Resp(global.CodeErrParam, fmt.Sprintf("{{.Key.Param}}: %s", err))
+    }
+
+    obj := {{$.Model}}{}
+    if err := ctx.DB().Where("{{.Key.Column}} = ?", value).First(&obj).Error; err != nil {
+        if err == gorm.ErrRecordNotFound {
+            return global.Resp(global.CodeErrNotFound, err.Error())
+        }
+        return global.Resp(global.CodeErrDB, err.Error())
+    }
+    keys := []Key{ { {{- range $i, $k := $.Keys}}{{if $i}}, {{end}}{{.Name}}: obj.{{.Name}}{{end -}} } }
+    {{- if $.Optimistic}}
+    versions, err := deleteVersions(ctx, 1)
+    if err != nil {
+        return global.Resp(global.CodeErrParam, err.Error())
+    }
+    {{- end}}
+    {{- if eq (len $.Keys) 1}}
+    _, resp := deleteKeys(ctx, keys, []string{fmt.Sprint(obj.{{(index $.Keys 0).Name}})}{{if $.Optimistic}}, versions{{end}})
+    {{- else}}
+    _, resp := deleteKeys(ctx, keys, keys{{if $.Optimistic}}, versions{{end}})
+    {{- end}}
+    return resp
+}
+{{end}}
+{{end}}
+{{if .Upsert}}
+// UpsertResult 创建或更新{{.Desc}}的结果
+type UpsertResult struct {
+    Created bool ` + "`json:\"created\"`" + ` // true 为创建 false 为更新
+    Data *{{.Model}} ` + "`json:\"data\"`" + `
+    Warning string ` + "`json:\"warning,omitempty\"`" + ` // 提交后 Func 的错误 数据已保存
+}
+
+// @Summary 创建或更新{{.Desc}}
+// @Description {{.PackageName}}.upsert
+// @Description 按 {{.UpsertKey.Column}} 查找 不存在时使用创建参数 存在时使用更新参数 UpdateRequest
+{{- range .Description}}
+// @Description {{.}}
+{{- end}}
+// @ID {{.PackageName}}.upsert
+// @Tags {{.PackageName}} {{.Tag}}
+{{- range .UpsertSecurity}}
+// @Security {{.}}
+{{- end}}
+{{- if .CreateJSON}}
+// @Accept  json
+{{- end}}
+{{- if .CreateForm}}
+// @Accept  x-www-form-urlencoded
+{{- end}}
+{{- if .CreateFile}}
+// @Accept  multipart/form-data
+{{- end}}
+// @Produce json
+// @Param      {{.UpsertKey.Param}}  path  {{.UpsertKey.Type}}  true  "{{.UpsertKey.Column}}"
+{{- if .Optimistic}}
+// @Param      {{.VersionJSON}}  query  integer  false  "更新时的版本号 也可以使用 If-Match"
+{{- end}}
+{{- if .CreateForm}}
+{{- if .CreateJSON}}
+// @Description 也可以使用 application/json 请求体 CreateRequest
+{{- end}}
+{{- range .CreateParamsDecs}} 
+{{.}} 
+{{- end}}
+{{- else}}
+// @Param      body           body       CreateRequest    true   "参数"
+{{- end}}
+// @Success    200            {object}   UpsertResult
+// @Resource /{{.PackageName}}
+// @Router /{{.PackageName}}/by-{{.UpsertKey.Param}}/{{printf "{%s}" .UpsertKey.Param}}    [PUT]
+func Upsert(ctx *ctx.Context) global.RespModel {
+    var value {{.UpsertKey.GoType}}
+    if err := bind.Key(ctx.Param("{{.UpsertKey.Param}}"), &value); err != nil {
+        return global.Resp(global.CodeErrParam, fmt.Sprintf("{{.UpsertKey.Param}}: %s", err))
+    }
+    // 创建冲突转为更新时需要再次读取请求体
+    body, err := ioutil.ReadAll(ctx.Request().Body)
+    if err != nil {
+        return global.Resp(global.CodeErrParam, err.Error())
+    }
+
+    obj := {{.Model}}{}
+    if err := ctx.DB().Where("{{.UpsertKey.Column}} = ?", value).First(&obj).Error; err != nil {
+        if err != gorm.ErrRecordNotFound {
+            return global.Resp(global.CodeErrDB, err.Error())
+        }
+
+        ctx.Request().Body = ioutil.NopCloser(bytes.NewReader(body))
+        req, err := BindCreateRequest(ctx)
+        if err != nil {
+            return global.Resp(global.CodeErrParam, err.Error())
+        }
+        {{- if .UpsertCreate}}
+        // 唯一列使用路径中的值
+        req.{{.UpsertKey.Name}} = &value
+        {{- end}}
+        if errs := req.Validate(); len(errs) > 0 {
+            return global.Resp(global.CodeErrParam, errs)
+        }
+
+        obj.{{.UpsertKey.Name}} = value
+        ok, resp := create(ctx, req, &obj)
+        if ok {
+            res := UpsertResult{Created: true, Data: &obj}
+            if err := createAfter(ctx, &obj); err != nil {
+                res.Warning = err.Error()
+            }
+            return global.Resp(global.CodeOK, res)
+        }
+        // 并发的请求已创建相同的数据时转为更新
+        obj = {{.Model}}{}
+        if err := ctx.DB().Where("{{.UpsertKey.Column}} = ?", value).First(&obj).Error; err != nil {
+            return resp
+        }
+    }
+    keys := []Key{ { {{- range $i, $k := .Keys}}{{if $i}}, {{end}}{{.Name}}: obj.{{.Name}}{{end -}} } }
+
+    ctx.Request().Body = ioutil.NopCloser(bytes.NewReader(body))
+    req, err := BindUpdateRequest(ctx)
+    if err != nil {
+        return global.Resp(global.CodeErrParam, err.Error())
+    }
+    {{- if .UpsertUpdate}}
+    // 唯一列由路径指定 不能修改
+    req.{{.UpsertKey.Name}} = nil
+    {{- end}}
+    if errs := req.Validate(); len(errs) > 0 {
+        return global.Resp(global.CodeErrParam, errs)
+    }
+
+    obj = {{.Model}}{}
+    ok, resp := update(ctx, keys, req, &obj)
+    if !ok {
+        return resp
+    }
+    res := UpsertResult{Created: false, Data: &obj}
+    if err := updateAfter(ctx, &obj); err != nil {
+        res.Warning = err.Error()
+    }
+    return global.Resp(global.CodeOK, res)
+}
+{{end}}
+{{if and .List .ListCursor}}
+// listCursor 游标 上一页最后一条数据的排序列
+type listCursor struct {
+    {{- range $i, $c := .ListCursorColumns}}
+    {{.Name}} {{.GoType}} ` + "`json:\"{{$i}}\"`" + `
+    {{- end}}
+}
+
+// encodeCursor 生成游标
+func encodeCursor(obj *{{.Model}}) string {
+    b, _ := json.Marshal(listCursor{ {{- range $i, $c := .ListCursorColumns}}{{if $i}}, {{end}}{{.Name}}: obj.{{.Name}}{{end -}} })
+    return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor 解析游标
+func decodeCursor(s string) (listCursor, error) {
+    c := listCursor{}
+    b, err := base64.RawURLEncoding.DecodeString(s)
+    if err != nil {
+        return c, err
+    }
+    return c, json.Unmarshal(b, &c)
+}
+
+// cursorWhere 游标之后的数据 before 时为之前的数据
+// (a > ?) OR (a = ? AND b > ?) 倒序的列使用 <
+func cursorWhere(db *gorm.DB, c listCursor, before bool) *gorm.DB {
+    cols := []string{ {{- range $i, $c := .ListCursorColumns}}{{if $i}}, {{end}}"{{.Column}}"{{end -}} }
+    desc := []bool{ {{- range $i, $c := .ListCursorColumns}}{{if $i}}, {{end}}{{.Desc}}{{end -}} }
+    vs := []interface{}{ {{- range $i, $c := .ListCursorColumns}}{{if $i}}, {{end}}c.{{.Name}}{{end -}} }
+    conds := make([]string, len(cols))
+    args := []interface{}{}
+    for i := range cols {
+        cond := []string{}
+        for j := 0; j < i; j++ {
+            cond = append(cond, cols[j]+" = ?")
+            args = append(args, vs[j])
+        }
+        op := " > ?"
+        if desc[i] != before {
+            op = " < ?"
+        }
+        conds[i] = "(" + strings.Join(append(cond, cols[i]+op), " AND ") + ")"
+        args = append(args, vs[i])
+    }
+    return db.Where(strings.Join(conds, " OR "), args...)
+}
+
+// cursorOrder 排序 before 时反向读取
+func cursorOrder(before bool) string {
+    if before {
+        return "{{range $i, $c := .ListCursorColumns}}{{if $i}}, {{end}}{{.Column}} {{if .Desc}}ASC{{else}}DESC{{end}}{{end}}"
+    }
+    return "{{range $i, $c := .ListCursorColumns}}{{if $i}}, {{end}}{{.Column}} {{if .Desc}}DESC{{else}}ASC{{end}}{{end}}"
+}
+{{end}}
+{{if .List}}
+// @Summary {{.Desc}}列表
+// @Description {{.PackageName}}.list
+{{- range .Description}}
+// @Description {{.}}
+{{- end}}
+// @ID {{.PackageName}}.list
+// @Tags {{.PackageName}} {{.Tag}}
+{{- range .ListSecurity}}
+// @Security {{.}}
+{{- end}}
+// @Produce json
+{{- if .ListCursor}}
+// @Description 游标分页 按{{range .ListCursorColumns}} {{.Column}}{{if .Desc}} 倒序{{end}}{{end}} 排序 不返回总数
+// @Param        after        query        string         false "下一页 响应头 X-Next-Cursor 的值"
+// @Param        before       query        string         false "上一页 响应头 X-Prev-Cursor 的值"
+{{- else}}
+// @Param        skip         query        integer        false "间隔"  mininum(0)
+{{- end}}
+// @Param        limit        query        integer        false "条数"  mininum(0) maxinum(100)  default(20)
+{{- if not .ListCursor}}
+// @Param        sort         query        string         false "排序"
+{{- end}}
+// @Param        fields       query        string         true  "请求字段"
+// @Param        filters      query        string         false "过滤条件"
+// @Success      200          {object}     {{.Model}}
+{{- if .Optimistic}}
+// @Header       200          {string}     ETag  "列表中的版本号 W/\"1,2\""
+{{- end}}
+{{- if .ListCursor}}
+// @Header       200          {string}     X-Next-Cursor  "下一页的游标 没有时为空"
+// @Header       200          {string}     X-Prev-Cursor  "上一页的游标 没有时为空"
+{{- end}}
+// @Resource /{{.PackageName}}
+// @Router /{{.PackageName}}       [get]
+func List(ctx *ctx.Context) global.RespModel {
+    objs := []{{.Model}}{}
+
+    {{range .ListBefore}}
+    if err := models.{{.Name}}(ctx,ctx.DB(),&objs); err != nil {
+        return global.Resp(global.CodeErrHandle,err.Error())
+    }
+    {{end}}
+
+    fields := utils.FiltersToMap(ctx.GetFields())
+
+    {{if .ListPreload}}
+    db := sqldb.Preload(ctx.DB(),fields,map[string]interface{}{
+        {{- range .ListPreloadV}}
+        "{{.}}",
+        {{end}}
+    })
+    {{else}}
+    db := ctx.DB()
+    {{end}}
+    {{- if .ListCursor}}
+    after, _ := ctx.GetStringv("after")
+    before, _ := ctx.GetStringv("before")
+    if after != "" && before != "" {
+        return global.Resp(global.CodeErrParam, "after,before")
+    }
+    limit := ctx.GetLimit()
+    if limit <= 0 {
+        limit = 20
+    }
+    if s := after + before; s != "" {
+        c, err := decodeCursor(s)
+        if err != nil {
+            return global.Resp(global.CodeErrParam, "cursor")
+        }
+        db = cursorWhere(db, c, before != "")
+    }
+
+    // 多读取一条判断是否还有数据
+    total, err := sqldb.FindWithJson(db.Order(cursorOrder(before != "")), new({{.Model}}), &objs, ctx.GetFilters(), "", 0, limit+1, false)
+	if err != nil {
+            return global.Resp(global.CodeErrDB,err.Error())
 	}
+    more := len(objs) > limit
+    if more {
+        objs = objs[:limit]
+    }
+    if before != "" {
+        // 向前翻页时倒序读取 恢复为正常顺序
+        for i, j := 0, len(objs)-1; i < j; i, j = i+1, j-1 {
+            objs[i], objs[j] = objs[j], objs[i]
+        }
+    }
+    // 向后翻页时多读取的一条表示存在下一页 向前翻页时表示存在上一页
+    next, prev := more, after != ""
+    if before != "" {
+        next, prev = true, more
+    }
+    if next && len(objs) > 0 {
+        ctx.Response().Header().Set("X-Next-Cursor", encodeCursor(&objs[len(objs)-1]))
+    }
+    if prev && len(objs) > 0 {
+        ctx.Response().Header().Set("X-Prev-Cursor", encodeCursor(&objs[0]))
+    }
+    {{- else}}
+	total, err := sqldb.FindWithJson(db, new({{.Model}}), &objs, ctx.GetFilters(), ctx.GetSort(), ctx.GetSkip(), ctx.GetLimit(), {{.ListTotal}})
+	if err != nil {
+            return global.Resp(global.CodeErrDB,err.Error())
+	}
+    {{- end}}
 
     {{range .ListAfter}}
     if err := models.{{.Name}}(ctx,ctx.DB(),&objs); err != nil {
         return global.Resp(global.CodeErrHandle,err.Error())
     }
-    {{end}}
+    {{end}}
+
+    {{- if .Optimistic}}
+    versions := make([]int64, len(objs))
+    for i := range objs {
+        versions[i] = int64(objs[i].{{.Version}})
+    }
+    ctx.Response().Header().Set("ETag", bind.ETag(versions...))
+    {{- end}}
+	return global.RespsWithFileds(global.CodeOK, total, objs, ctx.AppKey, fields)
+}
+{{end}}
+{{if .Count}}
+// @Summary {{.Desc}}数量
+// @Description {{.PackageName}}.count
+// @Description 条件与列表相同
+// @ID {{.PackageName}}.count
+// @Tags {{.PackageName}} {{.Tag}}
+{{- range .ListSecurity}}
+// @Security {{.}}
+{{- end}}
+// @Produce json
+// @Param        filters      query        string         false "过滤条件"
+// @Success      200          {integer}    integer        "数量"
+// @Resource /{{.PackageName}}
+// @Router /{{.PackageName}}/count       [get]
+func Count(ctx *ctx.Context) global.RespModel {
+    {{- if .ListBefore}}
+    // 与列表相同的 ListBefore
+    objs := []{{.Model}}{}
+    {{- range .ListBefore}}
+    if err := models.{{.Name}}(ctx,ctx.DB(),&objs); err != nil {
+        return global.Resp(global.CodeErrHandle,err.Error())
+    }
+    {{- end}}
+    {{- end}}
+    rows := []struct {
+        Count int64 ` + "`gorm:\"column:count\"`" + `
+    }{}
+    if _, err := sqldb.FindWithJson(ctx.DB().Select("COUNT(*) AS count"), new({{.Model}}), &rows, ctx.GetFilters(), "", 0, 1, false); err != nil {
+        return global.Resp(global.CodeErrDB, err.Error())
+    }
+    count := int64(0)
+    if len(rows) > 0 {
+        count = rows[0].Count
+    }
+    return global.Resp(global.CodeOK, count)
+}
+{{end}}
+{{if .Aggregate}}
+// aggregateRow 聚合查询的结果 只有请求的列有值
+type aggregateRow struct {
+    Count int64 ` + "`gorm:\"column:count\"`" + `
+    {{- range .AggGroups}}
+    G{{.Name}} {{.GoType}} ` + "`gorm:\"column:g_{{.Column}}\"`" + `
+    {{- end}}
+    {{- range .AggFields}}
+    {{- range .Funcs}}
+    {{.Field}} *float64 ` + "`gorm:\"column:{{.Alias}}\"`" + `
+    {{- end}}
+    {{- end}}
+}
+
+// @Summary {{.Desc}}分组聚合
+// @Description {{.PackageName}}.aggregate
+// @Description 条件与列表相同 返回每个分组的值 按分组字段排序 最多 {{.AggregateMax}} 个分组 超过时返回错误
+// @Description 返回 [{"status":1,"count":2,"sum_amount":3}] 聚合结果的字段名为 函数_字段
+// @ID {{.PackageName}}.aggregate
+// @Tags {{.PackageName}} {{.Tag}}
+{{- range .ListSecurity}}
+// @Security {{.}}
+{{- end}}
+// @Produce json
+// @Param        filters      query        string         false "过滤条件"
+// @Param        group        query        string         false "分组字段 多个以逗号分隔{{range .AggGroups}} {{.JSON}}{{end}}"
+// @Param        agg          query        string         false "聚合 多个以逗号分隔 默认 count: count{{range .AggFields}}{{range .Funcs}} {{.Key}}{{end}}{{end}}"
+// @Success      200          {array}      object
+// @Resource /{{.PackageName}}
+// @Router /{{.PackageName}}/aggregate       [get]
+func Aggregate(ctx *ctx.Context) global.RespModel {
+    groups, aggs := []string{}, []string{"count"}
+    if s, ok := ctx.GetStringv("group"); ok && s != "" {
+        groups = strings.Split(s, ",")
+    }
+    if s, ok := ctx.GetStringv("agg"); ok && s != "" {
+        aggs = strings.Split(s, ",")
+    }
+
+    {{- if .ListBefore}}
+    // 与列表相同的 ListBefore
+    objs := []{{.Model}}{}
+    {{- range .ListBefore}}
+    if err := models.{{.Name}}(ctx,ctx.DB(),&objs); err != nil {
+        return global.Resp(global.CodeErrHandle,err.Error())
+    }
+    {{- end}}
+    {{- end}}
+
+    selects, groupBy := []string{}, []string{}
+    for _, g := range groups {
+        switch g {
+        {{- range .AggGroups}}
+        case "{{.JSON}}":
+            selects = append(selects, "{{.Column}} AS g_{{.Column}}")
+            groupBy = append(groupBy, "{{.Column}}")
+        {{- end}}
+        default:
+            return global.Resp(global.CodeErrParam, "group: "+g)
+        }
+    }
+    for _, a := range aggs {
+        switch a {
+        case "count":
+            selects = append(selects, "COUNT(*) AS count")
+        {{- range .AggFields}}
+        {{- $f := .}}
+        {{- range .Funcs}}
+        case "{{.Key}}":
+            selects = append(selects, "{{.Func}}({{$f.Column}}) AS {{.Alias}}")
+        {{- end}}
+        {{- end}}
+        default:
+            return global.Resp(global.CodeErrParam, "agg: "+a)
+        }
+    }
+
+    db := ctx.DB().Select(strings.Join(selects, ", "))
+    if len(groupBy) > 0 {
+        // 按分组列排序 结果稳定
+        db = db.Group(strings.Join(groupBy, ", ")).Order(strings.Join(groupBy, ", "))
+    }
+    // 多读取一个分组判断是否超过上限
+    rows := []aggregateRow{}
+    if _, err := sqldb.FindWithJson(db, new({{.Model}}), &rows, ctx.GetFilters(), "", 0, {{.AggregateMax}}+1, false); err != nil {
+        return global.Resp(global.CodeErrDB, err.Error())
+    }
+    if len(rows) > {{.AggregateMax}} {
+        return global.Resp(global.CodeErrParam, "too many groups, max {{.AggregateMax}}")
+    }
 
-	return global.RespsWithFileds(global.CodeOK, total, objs, ctx.AppKey, fields)
+    res := make([]map[string]interface{}, len(rows))
+    for i, row := range rows {
+        m := map[string]interface{}{}
+        {{- if .AggGroups}}
+        for _, g := range groups {
+            switch g {
+            {{- range .AggGroups}}
+            case "{{.JSON}}":
+                m["{{.JSON}}"] = row.G{{.Name}}
+            {{- end}}
+            }
+        }
+        {{- end}}
+        for _, a := range aggs {
+            switch a {
+            case "count":
+                m["count"] = row.Count
+            {{- range .AggFields}}
+            {{- range .Funcs}}
+            case "{{.Key}}":
+                m["{{.JSON}}"] = row.{{.Field}}
+            {{- end}}
+            {{- end}}
+            }
+        }
+        res[i] = m
+    }
+    return global.Resp(global.CodeOK, res)
 }
 {{end}}
 {{if .Info}}
 // @Summary {{.Desc}}详情
 // @Description {{.PackageName}}.info
+{{- range .Description}}
+// @Description {{.}}
+{{- end}}
 // @ID {{.PackageName}}.info
-// @Tags {{.PackageName}} {{.Desc}}
+// @Tags {{.PackageName}} {{.Tag}}
 {{- range .InfoSecurity}}
 // @Security {{.}}
 {{- end}}
 // @Produce  json
-// @Param        id         path         string         true "id"
+{{- range .Keys}}
+// @Param      {{.Param}}  path  {{.Type}}  true  "{{.Column}}"
+{{- end}}
 // @Param        fields     query        string         true  "请求字段"
-// @Success      200        {object}     models.{{.Name}}
+// @Success      200        {object}     {{.Model}}
+{{- if .Optimistic}}
+// @Header       200        {string}     ETag  "版本号"
+{{- end}}
 // @Resource /{{.PackageName}}
-// @Router /{{.PackageName}}/{id}     [get]
+// @Router /{{.PackageName}}{{.KeyPath}}     [get]
 func Info(ctx *ctx.Context) global.RespModel {
-	obj :=models.{{.Name}}{} 
+    keys, err := ParseKeys(ctx)
+    if err != nil {
+        return global.Resp(global.CodeErrParam, err.Error())
+    }
+    if len(keys) != 1 {
+        return global.Resp(global.CodeErrParam, "{{(index .Keys 0).Param}}")
+    }
+
+    return info(ctx, func(db *gorm.DB) *gorm.DB {
+        return WhereKeys(db, keys)
+    })
+}
+
+// info 查询详情 Info 与 InfoByX 共用 where 为查询条件
+func info(ctx *ctx.Context, where func(*gorm.DB) *gorm.DB) global.RespModel {
+	obj :={{.Model}}{} 
 	
     {{range .InfoBefore}}
     if err := models.{{.Name}}(ctx,ctx.DB(),&obj); err != nil {
@@ -285,18 +1848,18 @@ func Info(ctx *ctx.Context) global.RespModel {
     fields := utils.FiltersToMap(ctx.GetFields())
 
     {{if .InfoPreload}}
-	if err :=sqldb.Preload(ctx.DB(),fields,map[string]interface{}{
+	if err :=where(sqldb.Preload(ctx.DB(),fields,map[string]interface{}{
         {{- range .InfoPreloadV}}
         "{{.}}",
         {{end}}
-    }).Where("{{.DBIndex}} = ?", ctx.ID()).First(&obj).Error; err != nil {
+    })).First(&obj).Error; err != nil {
         if err == gorm.ErrRecordNotFound{
             return global.Resp(global.CodeErrNotFound,err.Error())
         }
         return global.Resp(global.CodeErrDB,err.Error())
 	}
     {{else}}
-	if err :=ctx.DB().Where("{{.DBIndex}} = ?", ctx.ID()).First(&obj).Error; err != nil {
+	if err :=where(ctx.DB()).First(&obj).Error; err != nil {
         if err == gorm.ErrRecordNotFound{
             return global.Resp(global.CodeErrNotFound,err.Error())
         }
@@ -310,35 +1873,240 @@ func Info(ctx *ctx.Context) global.RespModel {
     }
     {{end}}
 
+    {{- if .Optimistic}}
+    ctx.Response().Header().Set("ETag", bind.ETag(int64(obj.{{.Version}})))
+    {{- end}}
 	return global.RespWithFileds(global.CodeOK, obj, ctx.AppKey, fields)
 }
 {{end}}
 {{if .Delete}}
 // @Summary 删除{{.Desc}}
 // @Description {{.PackageName}}.delete
+{{- range .Description}}
+// @Description {{.}}
+{{- end}}
 // @ID {{.PackageName}}.delete
-// @Tags {{.PackageName}} {{.Desc}}
+// @Tags {{.PackageName}} {{.Tag}}
 {{- range .DeleteSecurity}}
 // @Security {{.}}
 {{- end}}
 // @Accept  x-www-form-urlencoded
-// @Param        id               path       string    true "id"
+{{- range .Keys}}
+// @Param      {{.Param}}  path  {{.Type}}  true  "{{.Column}}"
+{{- end}}
+{{- if .Optimistic}}
+// @Param        {{.VersionJSON}}  query  []integer  false  "版本号 多个以逗号分隔 也可以使用 If-Match"  collectionFormat(csv)
+{{- end}}
 // @Success      200              {string}   string
 // @Resource     /{{.PackageName}}
-// @Router       /{{.PackageName}}/{id} [DELETE]
+// @Router       /{{.PackageName}}{{.KeyPath}} [DELETE]
 func Delete(ctx *ctx.Context) global.RespModel {
 
-    ids := strings.Split(ctx.ID(), ",")
+    keys, err := ParseKeys(ctx)
+    if err != nil {
+        return global.Resp(global.CodeErrParam, err.Error())
+    }
+    {{- if .Optimistic}}
+    versions, err := deleteVersions(ctx, len(keys))
+    if err != nil {
+        return global.Resp(global.CodeErrParam, err.Error())
+    }
+    {{- end}}
+    {{- if eq (len .Keys) 1}}
+    _, resp := deleteKeys(ctx, keys, strings.Split(ctx.ID(), ","){{if .Optimistic}}, versions{{end}})
+    {{- else}}
+    // 复合主键时 Func 接收 []Key
+    _, resp := deleteKeys(ctx, keys, keys{{if .Optimistic}}, versions{{end}})
+    {{- end}}
+    return resp
+}
+{{- if .Optimistic}}
+
+// deleteVersions 读取删除时的版本号 多个以逗号分隔
+func deleteVersions(ctx *ctx.Context, n int) ([]int64, error) {
+    vs := ctx.Request().Header.Get("If-Match")
+    if o, ok := ctx.GetStringv("{{.VersionJSON}}"); ok {
+        vs = o
+    }
+    versions, err := bind.Versions(vs)
+    if err != nil || len(versions) != n {
+        return nil, errors.New("{{.VersionJSON}}")
+    }
+    return versions, nil
+}
+{{- end}}
+
+// deleteKeys 删除 Delete DeleteByX 共用 ids 为传给 Func 的主键 返回是否成功
+func deleteKeys(ctx *ctx.Context, keys []Key, ids {{if eq (len .Keys) 1}}[]string{{else}}[]Key{{end}}{{if .Optimistic}}, versions []int64{{end}}) (bool, global.RespModel) {
 
     {{range .DeleteBefore}}
+    if err := models.{{.Name}}(ctx,ctx.DB(),ids); err != nil {
+        return false, global.Resp(global.CodeErrHandle,err.Error())
+    }
+    {{end}}
+
+    {{if .DeleteLock}}
+	tx, err := sqldb.NewTx(ctx.DB())
+	if err != nil {
+        return false, global.Resp(global.CodeErrDB,err.Error())
+	}
+	defer tx.End()
+
+    // 聚合查询不能加锁 读取 id 判断是否都存在
+    locked := []string{}
+    if err := WhereKeys(lock.For(tx.DB(), "{{.DeleteLock}}").Model(new({{.Model}})), keys).Pluck("{{.DBIndex}}", &locked).Error; err != nil {
+        return false, global.Resp(global.CodeErrDB,err.Error())
+    }
+    num := len(locked)
+    {{else}}
+	num := sqldb.Count(WhereKeys(ctx.DB(), keys), new({{.Model}}), true)
+    {{end}}
+
+	if int(num) != len(keys) {
+        return false, global.Resp(global.CodeErrParam,"id")
+	}
+
+    {{if not .DeleteLock}}
+	tx, err := sqldb.NewTx(ctx.DB())
+	if err != nil {
+        return false, global.Resp(global.CodeErrDB,err.Error())
+	}
+	defer tx.End()
+    {{end}}
+
+    if ok, resp := deleteTx(ctx, tx.DB(), keys, ids{{if .Optimistic}}, versions{{end}}); !ok {
+        return false, resp
+    }
+
+	if err := tx.Commit(); err != nil {
+        return false, global.Resp(global.CodeErrDB,err.Error())
+	}
+
+    {{range .DeleteAfter}}
+    if err := models.{{.Name}}(ctx,ctx.DB(),ids); err != nil {
+        return false, global.Resp(global.CodeErrHandle,err.Error())
+    }
+    {{end}}
+
+    return true, global.Resp(global.CodeOK,"")
+}
+
+// deleteTx 在事务中删除 不提交事务 deleteKeys DeleteFilter 共用
+func deleteTx(ctx *ctx.Context, db *gorm.DB, keys []Key, ids {{if eq (len .Keys) 1}}[]string{{else}}[]Key{{end}}{{if .Optimistic}}, versions []int64{{end}}) (bool, global.RespModel) {
+    {{range .DeleteTxBefore}}
+    if err := models.{{.Name}}(ctx,db,ids); err != nil {
+        return false, global.Resp(global.CodeErrHandle,err.Error())
+    }
+    {{end}}
+
+    {{- if .Optimistic}}
+    for i := range keys {
+        res := WhereKeys(db, keys[i:i+1]).Where("{{.VersionColumn}} = ?", versions[i]).Delete(new({{.Model}}))
+        if res.Error != nil {
+            return false, global.Resp(global.CodeErrDB,res.Error.Error())
+        }
+        if res.RowsAffected == 0 {
+            return false, global.Resp(global.CodeErrConflict, keys[i])
+        }
+    }
+    {{- else}}
+	if err := WhereKeys(db, keys).Delete(new({{.Model}})).Error; err != nil {
+        return false, global.Resp(global.CodeErrDB,err.Error())
+	}
+    {{- end}}
+
+    {{range .DeleteTxAfter}}
+    if err := models.{{.Name}}(ctx,db,ids); err != nil {
+        return false, global.Resp(global.CodeErrHandle,err.Error())
+    }
+    {{end}}
+
+    return true, global.Resp(global.CodeOK,"")
+}
+{{end}}
+{{if .Trash}}
+// @Summary {{.Desc}}回收站
+// @Description {{.PackageName}}.trash
+{{- range .Description}}
+// @Description {{.}}
+{{- end}}
+// @ID {{.PackageName}}.trash
+// @Tags {{.PackageName}} {{.Tag}}
+{{- range .TrashSecurity}}
+// @Security {{.}}
+{{- end}}
+// @Produce json
+// @Param        skip         query        integer        false "间隔"  mininum(0)
+// @Param        limit        query        integer        false "条数"  mininum(0) maxinum(100)  default(20)
+// @Param        sort         query        string         false "排序"
+// @Param        fields       query        string         true  "请求字段"
+// @Param        filters      query        string         false "过滤条件"
+// @Success      200          {object}     {{.Model}}
+// @Resource /{{.PackageName}}
+// @Router /{{.PackageName}}/trash       [get]
+func Trash(ctx *ctx.Context) global.RespModel {
+    objs := []{{.Model}}{}
+
+    {{range .TrashBefore}}
+    if err := models.{{.Name}}(ctx,ctx.DB(),&objs); err != nil {
+        return global.Resp(global.CodeErrHandle,err.Error())
+    }
+    {{end}}
+
+    fields := utils.FiltersToMap(ctx.GetFields())
+
+	total, err := sqldb.FindWithJson(ctx.DB().Unscoped().Where("{{.DeletedAt}} IS NOT NULL"), new({{.Model}}), &objs, ctx.GetFilters(), ctx.GetSort(), ctx.GetSkip(), ctx.GetLimit(), true)
+	if err != nil {
+            return global.Resp(global.CodeErrDB,err.Error())
+	}
+
+    {{range .TrashAfter}}
+    if err := models.{{.Name}}(ctx,ctx.DB(),&objs); err != nil {
+        return global.Resp(global.CodeErrHandle,err.Error())
+    }
+    {{end}}
+
+	return global.RespsWithFileds(global.CodeOK, total, objs, ctx.AppKey, fields)
+}
+{{end}}
+{{if .Restore}}
+// @Summary 恢复{{.Desc}}
+// @Description {{.PackageName}}.restore
+// @Description 恢复回收站中的数据 多个以逗号分隔
+// @ID {{.PackageName}}.restore
+// @Tags {{.PackageName}} {{.Tag}}
+{{- range .RestoreSecurity}}
+// @Security {{.}}
+{{- end}}
+{{- range .Keys}}
+// @Param      {{.Param}}  path  {{.Type}}  true  "{{.Column}}"
+{{- end}}
+// @Success      200              {string}   string
+// @Resource     /{{.PackageName}}
+// @Router       /{{.PackageName}}{{.KeyPath}}/restore [POST]
+func Restore(ctx *ctx.Context) global.RespModel {
+
+    keys, err := ParseKeys(ctx)
+    if err != nil {
+        return global.Resp(global.CodeErrParam, err.Error())
+    }
+    {{- if or .RestoreBefore .RestoreTxBefore .RestoreTxAfter .RestoreAfter}}
+    {{- if eq (len .Keys) 1}}
+    ids := strings.Split(ctx.ID(), ",")
+    {{- else}}
+    ids := keys
+    {{- end}}
+    {{- end}}
+
+    {{range .RestoreBefore}}
     if err := models.{{.Name}}(ctx,ctx.DB(),ids); err != nil {
         return global.Resp(global.CodeErrHandle,err.Error())
     }
     {{end}}
 
-	num := sqldb.Count(ctx.DB().Where("{{.DBIndex}} in (?)", ids), new(models.{{.Name}}), true)
+	num := sqldb.Count(WhereKeys(ctx.DB().Unscoped().Where("{{.DeletedAt}} IS NOT NULL"), keys), new({{.Model}}), true)
 
-	if int(num) != len(ids) {
+	if int(num) != len(keys) {
         return global.Resp(global.CodeErrParam,"id")
 	}
 
@@ -348,17 +2116,17 @@ func Delete(ctx *ctx.Context) global.RespModel {
 	}
 	defer tx.End()
 
-    {{range .DeleteTxBefore}}
+    {{range .RestoreTxBefore}}
     if err := models.{{.Name}}(ctx,tx.DB(),ids); err != nil {
         return global.Resp(global.CodeErrHandle,err.Error())
     }
     {{end}}
 
-	if err := tx.DB().Delete(new(models.{{.Name}}),"{{.DBIndex}} in (?)", ids).Error; err != nil {
+	if err := WhereKeys(tx.DB().Unscoped().Model(new({{.Model}})), keys).UpdateColumn("{{.DeletedAt}}", nil).Error; err != nil {
         return global.Resp(global.CodeErrDB,err.Error())
 	}
 
-    {{range .DeleteTxAfter}}
+    {{range .RestoreTxAfter}}
     if err := models.{{.Name}}(ctx,tx.DB(),ids); err != nil {
         return global.Resp(global.CodeErrHandle,err.Error())
     }
@@ -368,14 +2136,490 @@ func Delete(ctx *ctx.Context) global.RespModel {
         return global.Resp(global.CodeErrDB,err.Error())
 	}
 
-    {{range .DeleteAfter}}
+    {{range .RestoreAfter}}
+    if err := models.{{.Name}}(ctx,ctx.DB(),ids); err != nil {
+        return global.Resp(global.CodeErrHandle,err.Error())
+    }
+    {{end}}
+
+    return global.Resp(global.CodeOK,"")
+}
+{{end}}
+{{if .Purge}}
+// @Summary 彻底删除{{.Desc}}
+// @Description {{.PackageName}}.purge
+// @Description 彻底删除回收站中的数据 多个以逗号分隔
+// @ID {{.PackageName}}.purge
+// @Tags {{.PackageName}} {{.Tag}}
+{{- range .PurgeSecurity}}
+// @Security {{.}}
+{{- end}}
+{{- range .Keys}}
+// @Param      {{.Param}}  path  {{.Type}}  true  "{{.Column}}"
+{{- end}}
+// @Success      200              {string}   string
+// @Resource     /{{.PackageName}}
+// @Router       /{{.PackageName}}{{.KeyPath}}/purge [DELETE]
+func Purge(ctx *ctx.Context) global.RespModel {
+
+    keys, err := ParseKeys(ctx)
+    if err != nil {
+        return global.Resp(global.CodeErrParam, err.Error())
+    }
+    {{- if or .PurgeBefore .PurgeTxBefore .PurgeTxAfter .PurgeAfter}}
+    {{- if eq (len .Keys) 1}}
+    ids := strings.Split(ctx.ID(), ",")
+    {{- else}}
+    ids := keys
+    {{- end}}
+    {{- end}}
+
+    {{range .PurgeBefore}}
+    if err := models.{{.Name}}(ctx,ctx.DB(),ids); err != nil {
+        return global.Resp(global.CodeErrHandle,err.Error())
+    }
+    {{end}}
+
+    // 只能彻底删除回收站中的数据
+	num := sqldb.Count(WhereKeys(ctx.DB().Unscoped().Where("{{.DeletedAt}} IS NOT NULL"), keys), new({{.Model}}), true)
+
+	if int(num) != len(keys) {
+        return global.Resp(global.CodeErrParam,"id")
+	}
+
+	tx, err := sqldb.NewTx(ctx.DB())
+	if err != nil {
+        return global.Resp(global.CodeErrDB,err.Error())
+	}
+	defer tx.End()
+
+    {{range .PurgeTxBefore}}
+    if err := models.{{.Name}}(ctx,tx.DB(),ids); err != nil {
+        return global.Resp(global.CodeErrHandle,err.Error())
+    }
+    {{end}}
+
+	if err := WhereKeys(tx.DB().Unscoped().Where("{{.DeletedAt}} IS NOT NULL"), keys).Delete(new({{.Model}})).Error; err != nil {
+        return global.Resp(global.CodeErrDB,err.Error())
+	}
+
+    {{range .PurgeTxAfter}}
+    if err := models.{{.Name}}(ctx,tx.DB(),ids); err != nil {
+        return global.Resp(global.CodeErrHandle,err.Error())
+    }
+    {{end}}
+
+	if err := tx.Commit(); err != nil {
+        return global.Resp(global.CodeErrDB,err.Error())
+	}
+
+    {{range .PurgeAfter}}
     if err := models.{{.Name}}(ctx,ctx.DB(),ids); err != nil {
-        return global.Resp(global.CodeErrHandleHandle,err.Error())
+        return global.Resp(global.CodeErrHandle,err.Error())
     }
     {{end}}
 
     return global.Resp(global.CodeOK,"")
 }
 {{end}}
+{{if .Batch}}
+// @Summary 批量创建{{.Desc}}
+// @Description {{.PackageName}}.batch
+// @Description 请求体为 CreateRequest 数组 最多 {{.BatchMax}} 条 在同一个事务中创建
+{{- if .BatchPartial}}
+// @Description 跳过失败的数据 errors 中返回每条数据的错误
+{{- else}}
+// @Description 任意一条失败时全部失败 返回每条数据的错误
+{{- end}}
+// @ID {{.PackageName}}.batch
+// @Tags {{.PackageName}} {{.Tag}}
+{{- range .BatchSecurity}}
+// @Security {{.}}
+{{- end}}
+// @Accept  json
+// @Produce json
+// @Param      body           body       []CreateRequest    true   "参数"
+// @Success    200            {object}   batch.Result
+// @Resource /{{.PackageName}}
+// @Router /{{.PackageName}}/batch    [POST]
+func BatchCreate(ctx *ctx.Context) global.RespModel {
+    raws := []json.RawMessage{}
+    if err := json.NewDecoder(ctx.Request().Body).Decode(&raws); err != nil {
+        return global.Resp(global.CodeErrParam, err.Error())
+    }
+    if len(raws) == 0 || len(raws) > {{.BatchMax}} {
+        return global.Resp(global.CodeErrParam, "items: 1-{{.BatchMax}}")
+    }
+
+    res := batch.NewResult(len(raws))
+    reqs := make([]CreateRequest, len(raws))
+    objs := make([]{{.Model}}, len(raws))
+    for i, data := range raws {
+        if err := json.Unmarshal(data, &reqs[i]); err != nil {
+            res.Fail(i, err)
+            continue
+        }
+        {{- if .CreateNullable}}
+        reqs[i].Null = bind.Nulls(data{{range .CreateParams}}{{if .NullKind}}, "{{.JSON}}"{{end}}{{end}})
+        {{- end}}
+        if errs := reqs[i].Validate(); len(errs) > 0 {
+            res.Fail(i, errs)
+        }
+    }
+    {{- if not .BatchPartial}}
+    if res.HasError() {
+        return global.Resp(global.CodeErrParam, res.Errors)
+    }
+    {{- end}}
+
+    for i := range objs {
+        if res.Failed(i) {
+            continue
+        }
+        {{- range .CreateBefore}}
+        if err := models.{{.Name}}(ctx,ctx.DB(),&objs[i]); err != nil {
+            res.Fail(i, err)
+            continue
+        }
+        {{- end}}
+        reqs[i].ApplyTo(&objs[i])
+    }
+    {{- if not .BatchPartial}}
+    if res.HasError() {
+        return global.Resp(global.CodeErrHandle, res.Errors)
+    }
+    {{- end}}
+
+    tx, err := sqldb.NewTx(ctx.DB())
+	if err != nil {
+        return global.Resp(global.CodeErrDB,err.Error())
+	}
+	defer tx.End()
+
+    for i := range objs {
+        if res.Failed(i) {
+            continue
+        }
+        {{- if .BatchPartial}}
+        if err := batch.SavePoint(tx.DB()); err != nil {
+            return global.Resp(global.CodeErrDB,err.Error())
+        }
+        {{- end}}
+        {{- if not .BatchPartial}}
+        // 事务中的数据库错误返回 CodeErrDB
+        code := global.CodeErrHandle
+        {{- end}}
+        err := func() error {
+            {{- range .CreateTxBefore}}
+            if err := models.{{.Name}}(ctx,tx.DB(),&objs[i]); err != nil {
+                return err
+            }
+            {{- end}}
+            {{- if .CreateSave}}
+            if err := tx.DB().Create(&objs[i]).Error; err != nil {
+                {{- if not $.BatchPartial}}
+                code = global.CodeErrDB
+                {{- end}}
+                return err
+            }
+            {{- end}}
+            {{- range .CreateTxAfter}}
+            if err := models.{{.Name}}(ctx,tx.DB(),&objs[i]); err != nil {
+                return err
+            }
+            {{- end}}
+            return nil
+        }()
+        {{- if .BatchPartial}}
+        if err != nil {
+            res.Fail(i, err)
+            if err := batch.RollbackTo(tx.DB()); err != nil {
+                return global.Resp(global.CodeErrDB,err.Error())
+            }
+            continue
+        }
+        if err := batch.Release(tx.DB()); err != nil {
+            return global.Resp(global.CodeErrDB,err.Error())
+        }
+        {{- else}}
+        if err != nil {
+            return global.Resp(code, res.Fail(i, err))
+        }
+        {{- end}}
+    }
+
+	if err := tx.Commit(); err != nil {
+        return global.Resp(global.CodeErrDB,err.Error())
+	}
+
+    items := []{{.Model}}{}
+    for i := range objs {
+        if res.Failed(i) {
+            continue
+        }
+        {{- if .CreateAfter}}
+        // 数据已提交 Func 的错误作为警告返回
+        {{- end}}
+        {{- range $j, $f := .CreateAfter}}
+        {{if $j}}} else {{end}}if err := models.{{.Name}}(ctx,ctx.DB(),&objs[i]); err != nil {
+            res.Warn(i, err)
+        {{- end}}
+        {{- if .CreateAfter}}
+        }
+        {{- end}}
+        items = append(items, objs[i])
+    }
+    res.Success = len(items)
+    res.Items = items
+    return global.Resp(global.CodeOK, res)
+}
+{{end}}
+{{if .BatchUpdate}}
+// @Summary 批量更新{{.Desc}}
+// @Description {{.PackageName}}.batch-update
+// @Description 请求体为数组 每条数据包含主键{{range .Keys}} {{.Param}}{{end}}{{if .Optimistic}} 版本号 {{.VersionJSON}}{{end}} 与 UpdateRequest 的参数
+// @Description 最多 {{.BatchUpdateMax}} 条 在同一个事务中更新
+{{- if .BatchUpdatePartial}}
+// @Description 跳过失败的数据 errors 中返回每条数据的错误
+{{- else}}
+// @Description 任意一条失败时全部失败 返回每条数据的错误
+{{- end}}
+// @ID {{.PackageName}}.batch-update
+// @Tags {{.PackageName}} {{.Tag}}
+{{- range .BatchUpdateSecurity}}
+// @Security {{.}}
+{{- end}}
+// @Accept  json
+// @Produce json
+// @Param      body           body       []UpdateRequest    true   "参数"
+// @Success    200            {object}   batch.Result
+// @Resource /{{.PackageName}}
+// @Router /{{.PackageName}}/batch-update    [POST]
+func BatchUpdate(ctx *ctx.Context) global.RespModel {
+    raws := []json.RawMessage{}
+    if err := json.NewDecoder(ctx.Request().Body).Decode(&raws); err != nil {
+        return global.Resp(global.CodeErrParam, err.Error())
+    }
+    if len(raws) == 0 || len(raws) > {{.BatchUpdateMax}} {
+        return global.Resp(global.CodeErrParam, "items: 1-{{.BatchUpdateMax}}")
+    }
+
+    res := batch.NewResult(len(raws))
+    keys := make([]Key, len(raws))
+    reqs := make([]UpdateRequest, len(raws))
+    objs := make([]{{.Model}}, len(raws))
+    {{- if .Optimistic}}
+    versions := make([]int64, len(raws))
+    {{- end}}
+    {{- if .UpdatePatch}}
+    changed := make([][]string, len(raws))
+    {{- end}}
+    for i, data := range raws {
+        if ms := bind.Missing(data{{range .Keys}}, "{{.Param}}"{{end}}); len(ms) > 0 {
+            res.Fail(i, "missing "+strings.Join(ms, ","))
+            continue
+        }
+        if err := json.Unmarshal(data, &keys[i]); err != nil {
+            res.Fail(i, err)
+            continue
+        }
+        if err := json.Unmarshal(data, &reqs[i]); err != nil {
+            res.Fail(i, err)
+            continue
+        }
+        {{- if .UpdateNullable}}
+        reqs[i].Null = bind.Nulls(data{{range .UpdateParams}}{{if .NullKind}}, "{{.JSON}}"{{end}}{{end}})
+        {{- end}}
+        {{- if .Optimistic}}
+        v := struct {
+            Version *int64 ` + "`json:\"{{.VersionJSON}}\"`" + `
+        }{}
+        if err := json.Unmarshal(data, &v); err != nil || v.Version == nil {
+            res.Fail(i, "missing {{.VersionJSON}}")
+            continue
+        }
+        versions[i] = *v.Version
+        {{- end}}
+        if errs := reqs[i].Validate(); len(errs) > 0 {
+            res.Fail(i, errs)
+            continue
+        }
+        {{- if .UpdatePatch}}
+        changed[i] = reqs[i].Changed()
+        {{- end}}
+    }
+    {{- if not .BatchUpdatePartial}}
+    if res.HasError() {
+        return global.Resp(global.CodeErrParam, res.Errors)
+    }
+    {{- end}}
+
+    for i := range objs {
+        if res.Failed(i) {
+            continue
+        }
+        {{- if .UpdatePatch}}
+        ctx.Set(bind.ChangedKey, changed[i])
+        {{- end}}
+        {{- range .UpdateBefore}}
+        if err := models.{{.Name}}(ctx,ctx.DB(),&objs[i]); err != nil {
+            res.Fail(i, err)
+            continue
+        }
+        {{- end}}
+        {{- if not .UpdateLock}}
+        if err := WhereKeys(ctx.DB(), keys[i:i+1]).First(&objs[i]).Error; err != nil {
+            res.Fail(i, err)
+            continue
+        }
+        {{- if .Optimistic}}
+        if int64(objs[i].{{.Version}}) != versions[i] {
+            res.Fail(i, "{{.VersionJSON}}: conflict")
+            continue
+        }
+        {{- end}}
+        reqs[i].ApplyTo(&objs[i])
+        {{- end}}
+    }
+    {{- if not .BatchUpdatePartial}}
+    if res.HasError() {
+        return global.Resp(global.CodeErrHandle, res.Errors)
+    }
+    {{- end}}
+
+    tx, err := sqldb.NewTx(ctx.DB())
+	if err != nil {
+        return global.Resp(global.CodeErrDB,err.Error())
+	}
+	defer tx.End()
+
+    for i := range objs {
+        if res.Failed(i) {
+            continue
+        }
+        {{- if .UpdatePatch}}
+        ctx.Set(bind.ChangedKey, changed[i])
+        {{- end}}
+        {{- if .BatchUpdatePartial}}
+        if err := batch.SavePoint(tx.DB()); err != nil {
+            return global.Resp(global.CodeErrDB,err.Error())
+        }
+        {{- end}}
+        {{- if not .BatchUpdatePartial}}
+        // 事务中的数据库错误返回 CodeErrDB 版本冲突返回 CodeErrConflict
+        code := global.CodeErrHandle
+        {{- end}}
+        err := func() error {
+            {{- if .UpdateLock}}
+            if err := WhereKeys(lock.For(tx.DB(), "{{.UpdateLock}}"), keys[i:i+1]).First(&objs[i]).Error; err != nil {
+                {{- if not $.BatchUpdatePartial}}
+                code = global.CodeErrDB
+                {{- end}}
+                return err
+            }
+            {{- if .Optimistic}}
+            if int64(objs[i].{{.Version}}) != versions[i] {
+                {{- if not $.BatchUpdatePartial}}
+                code = global.CodeErrConflict
+                {{- end}}
+                return errors.New("{{.VersionJSON}}: conflict")
+            }
+            {{- end}}
+            reqs[i].ApplyTo(&objs[i])
+            {{- end}}
+            {{- if .Optimistic}}
+            r := WhereKeys(tx.DB().Model(new({{.Model}})), keys[i:i+1]).Where("{{.VersionColumn}} = ?", versions[i]).UpdateColumn("{{.VersionColumn}}", gorm.Expr("{{.VersionColumn}} + 1"))
+            if r.Error != nil {
+                {{- if not $.BatchUpdatePartial}}
+                code = global.CodeErrDB
+                {{- end}}
+                return r.Error
+            }
+            if r.RowsAffected == 0 {
+                {{- if not $.BatchUpdatePartial}}
+                code = global.CodeErrConflict
+                {{- end}}
+                return errors.New("{{.VersionJSON}}: conflict")
+            }
+            objs[i].{{.Version}}++
+            {{- end}}
+            {{- range .UpdateTxBefore}}
+            if err := models.{{.Name}}(ctx,tx.DB(),&objs[i]); err != nil {
+                return err
+            }
+            {{- end}}
+            {{- if .UpdateSave}}
+            {{- if .UpdatePatch}}
+            if len(changed[i]) > 0 {
+                if err := WhereKeys(tx.DB().Model(&objs[i]), keys[i:i+1]).Updates(reqs[i].Columns(&objs[i], changed[i])).Error; err != nil {
+                    {{- if not $.BatchUpdatePartial}}
+                    code = global.CodeErrDB
+                    {{- end}}
+                    return err
+                }
+            }
+            {{- else}}
+            if err := WhereKeys(tx.DB().Model(&objs[i]), keys[i:i+1]).Updates(saveColumns(tx.DB(), &objs[i])).Error; err != nil {
+                {{- if not $.BatchUpdatePartial}}
+                code = global.CodeErrDB
+                {{- end}}
+                return err
+            }
+            {{- end}}
+            {{- end}}
+            {{- range .UpdateTxAfter}}
+            if err := models.{{.Name}}(ctx,tx.DB(),&objs[i]); err != nil {
+                return err
+            }
+            {{- end}}
+            return nil
+        }()
+        {{- if .BatchUpdatePartial}}
+        if err != nil {
+            res.Fail(i, err)
+            if err := batch.RollbackTo(tx.DB()); err != nil {
+                return global.Resp(global.CodeErrDB,err.Error())
+            }
+            continue
+        }
+        if err := batch.Release(tx.DB()); err != nil {
+            return global.Resp(global.CodeErrDB,err.Error())
+        }
+        {{- else}}
+        if err != nil {
+            return global.Resp(code, res.Fail(i, err))
+        }
+        {{- end}}
+    }
+
+	if err := tx.Commit(); err != nil {
+        return global.Resp(global.CodeErrDB,err.Error())
+	}
+
+    items := []{{.Model}}{}
+    for i := range objs {
+        if res.Failed(i) {
+            continue
+        }
+        {{- if .UpdatePatch}}
+        ctx.Set(bind.ChangedKey, changed[i])
+        {{- end}}
+        {{- if .UpdateAfter}}
+        // 数据已提交 Func 的错误作为警告返回
+        {{- end}}
+        {{- range $j, $f := .UpdateAfter}}
+        {{if $j}}} else {{end}}if err := models.{{.Name}}(ctx,ctx.DB(),&objs[i]); err != nil {
+            res.Warn(i, err)
+        {{- end}}
+        {{- if .UpdateAfter}}
+        }
+        {{- end}}
+        items = append(items, objs[i])
+    }
+    res.Success = len(items)
+    res.Items = items
+    return global.Resp(global.CodeOK, res)
+}
+{{end}}
 `))
 )
@@ -0,0 +1,195 @@
+package generate
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+// render 解析模型源码并生成代码 返回类型名对应的代码
+func render(t *testing.T, src string) map[string]string {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "models.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{Defs: map[*ast.Ident]types.Object{}, Types: map[ast.Expr]types.TypeAndValue{}}
+	if _, err := (&types.Config{}).Check("example.com/org/proj/app/models", fset, []*ast.File{file}, info); err != nil {
+		t.Fatal(err)
+	}
+	g := NewGenerator(1, "", "", false, false, "")
+	g.Project = "example.com/org/proj"
+	g.Pkg = &Package{Name: "models", Path: "example.com/org/proj/app/models", defs: info.Defs, types: info.Types}
+	f := &File{g: g, name: "models.go", file: file, pkg: g.Pkg}
+	ast.Inspect(file, f.genDecl)
+
+	out := map[string]string{}
+	for _, m := range f.mappers {
+		r := m.Render()
+		buf := &bytes.Buffer{}
+		if err := cT.Execute(buf, &r); err != nil {
+			t.Fatal(err)
+		}
+		out[m.Name] = buf.String()
+	}
+	return out
+}
+
+func TestUpdateWhereKeys(t *testing.T) {
+	// dbindex 主键不是 gorm 主键 gorm 不会为更新添加条件
+	src := `package models
+
+// @tg Update:mode=patch UpdateFilter batch
+type Stock struct {
+	TenantID int64  ` + "`dbindex:\"tenant_id,sku\"`" + `
+	Sku      string ` + "`json:\"sku\" params:\"c\"`" + `
+	Qty      int64  ` + "`json:\"qty\" params:\"cu\"`" + `
+}
+`
+	code := render(t, src)["Stock"]
+	if code == "" {
+		t.Fatal("Stock not generated")
+	}
+	if strings.Contains(code, ".Model(obj).Updates(") || strings.Contains(code, ".Model(&objs[i]).Updates(") {
+		t.Fatal("update without keys")
+	}
+	for _, s := range []string{
+		"WhereKeys(tx.DB().Model(obj), keys).Updates(req.Columns(obj, changed))",
+		"WhereKeys(tx.DB().Model(&objs[i]), keys[i:i+1]).Updates(reqs[i].Columns(&objs[i], changed[i]))",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("missing %s", s)
+		}
+	}
+	if n := strings.Count(code, "WhereKeys(tx.DB().Model(obj), keys).Updates("); n != 2 {
+		t.Fatalf("update and update filter: want 2 got %d", n)
+	}
+}
+
+func TestSaveWhereKeys(t *testing.T) {
+	// gorm 主键为空时 Save 会插入新数据
+	src := `package models
+
+// @tg UpdateFilter batch
+type Ledger struct {
+	TenantID int64  ` + "`dbindex:\"tenant_id,code\"`" + `
+	Code     string ` + "`json:\"code\" params:\"c\"`" + `
+	Amount   int64  ` + "`json:\"amount\" params:\"cu\"`" + `
+}
+`
+	code := render(t, src)["Ledger"]
+	if strings.Contains(code, ".Save(") {
+		t.Fatal("update with Save")
+	}
+	for s, n := range map[string]int{
+		"WhereKeys(tx.DB().Model(obj), keys).Updates(saveColumns(tx.DB(), obj))":                  2,
+		"WhereKeys(tx.DB().Model(&objs[i]), keys[i:i+1]).Updates(saveColumns(tx.DB(), &objs[i]))": 1,
+	} {
+		if c := strings.Count(code, s); c != n {
+			t.Fatalf("%s: want %d got %d", s, n, c)
+		}
+	}
+}
+
+func TestVersionParam(t *testing.T) {
+	src := `package models
+
+// @tg Update:optimistic Delete DeleteFilter UpdateFilter
+type Order struct {
+	ID      int64  ` + "`gorm:\"primary_key\"`" + `
+	Name    string ` + "`json:\"name\" params:\"cu\"`" + `
+	Version int64  ` + "`json:\"version\"`" + `
+}
+`
+	code := render(t, src)["Order"]
+	if strings.Contains(code, "version  query  string") {
+		t.Fatal("version param should be integer")
+	}
+	if !strings.Contains(code, "version  query  integer") {
+		t.Fatal("missing version param")
+	}
+}
+
+func TestBatchAtomicCode(t *testing.T) {
+	src := `package models
+
+// @tg batch
+type Ledger struct {
+	TenantID int64  ` + "`dbindex:\"tenant_id,code\"`" + `
+	Code     string ` + "`json:\"code\" params:\"c\"`" + `
+	Amount   int64  ` + "`json:\"amount\" params:\"cu\"`" + `
+}
+`
+	code := render(t, src)["Ledger"]
+	if strings.Contains(code, "global.Resp(global.CodeErrHandle, res.Fail(i, err))") {
+		t.Fatal("atomic batch returns CodeErrHandle for db errors")
+	}
+	if n := strings.Count(code, "code = global.CodeErrDB"); n != 2 {
+		t.Fatalf("want 2 CodeErrDB got %d", n)
+	}
+}
+
+func TestDeleteFilterTx(t *testing.T) {
+	src := `package models
+
+// @tg Delete DeleteFilter
+type Item struct {
+	ID   int64  ` + "`gorm:\"primary_key\"`" + `
+	Name string ` + "`json:\"name\" params:\"cu\"`" + `
+}
+
+// @tg ListBefore:Item
+func ScopeItem(c, db interface{}, objs *[]Item) error { return nil }
+`
+	code := render(t, src)["Item"]
+	i := strings.Index(code, "func DeleteFilter(")
+	if i < 0 {
+		t.Fatal("missing DeleteFilter")
+	}
+	code = code[i:]
+	code = code[:strings.Index(code, "\n}\n")]
+	for _, s := range []string{
+		"models.ScopeItem(ctx,tx.DB(),&objs)",
+		"sqldb.FindWithJson(tx.DB(), new(models.Item)",
+		"deleteTx(ctx, tx.DB(), keys, ids)",
+		"tx.Commit()",
+	} {
+		if !strings.Contains(code, s) {
+			t.Fatalf("missing %s", s)
+		}
+	}
+	if strings.Contains(code, "ctx.DB(), new(") {
+		t.Fatal("DeleteFilter reads rows outside the tx")
+	}
+}
+
+func TestUpdateFilterListBefore(t *testing.T) {
+	src := `package models
+
+// @tg UpdateFilter
+type Item struct {
+	ID   int64  ` + "`gorm:\"primary_key\"`" + `
+	Name string ` + "`json:\"name\" params:\"cu\"`" + `
+}
+
+// @tg ListBefore:Item
+func ScopeItem(c, db interface{}, objs *[]Item) error { return nil }
+`
+	code := render(t, src)["Item"]
+	i := strings.Index(code, "func UpdateFilter(")
+	if i < 0 {
+		t.Fatal("missing UpdateFilter")
+	}
+	code = code[i:]
+	code = code[:strings.Index(code, "\n}\n")]
+	hook := strings.Index(code, "models.ScopeItem(ctx,tx.DB(),&objs)")
+	find := strings.Index(code, "sqldb.FindWithJson(tx.DB(), new(models.Item), &objs, filters")
+	if hook < 0 || find < 0 || hook > find {
+		t.Fatalf("ListBefore must run before the filter query: %d %d", hook, find)
+	}
+}
@@ -9,4 +9,5 @@ require (
 	github.com/sirupsen/logrus v1.4.2
 	github.com/stretchr/testify v1.4.0
 	golang.org/x/tools v0.0.0-20191127201027-ecd32218bd7f
+	gopkg.in/yaml.v2 v2.2.2
 )
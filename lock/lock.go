@@ -0,0 +1,37 @@
+// Package lock 生成代码使用的行锁
+package lock
+
+import (
+	"github.com/nzlov/gorm"
+)
+
+// 锁模式 Update:lock=update Delete:lock=share
+const (
+	Update = "update"
+	Share  = "share"
+)
+
+// For 在查询后追加行锁 需要在事务中使用
+// 支持 mysql postgres, sqlite 没有行锁 写事务本身是串行的 其他数据库不追加任何内容
+func For(db *gorm.DB, mode string) *gorm.DB {
+	if o := option(db.Dialect().GetName(), mode); o != "" {
+		return db.Set("gorm:query_option", o)
+	}
+	return db
+}
+
+func option(dialect, mode string) string {
+	switch dialect {
+	case "mysql":
+		if mode == Share {
+			return "LOCK IN SHARE MODE"
+		}
+		return "FOR UPDATE"
+	case "postgres":
+		if mode == Share {
+			return "FOR SHARE"
+		}
+		return "FOR UPDATE"
+	}
+	return ""
+}
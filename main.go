@@ -15,6 +15,7 @@ var (
 	verbose     = flag.Bool("verbose", false, "verbose")
 	gonum       = flag.Int("gonum", 5, "go num")
 	debug       = flag.Bool("debug", false, "debug log")
+	spec        = flag.String("spec", "", "annotation spec file (yaml/json)")
 )
 
 func main() {
@@ -33,6 +34,9 @@ func main() {
 
 	g := generate.NewGenerator(*gonum, *trimprefix, *output, *linecomment, *debug, *template)
 	g.ParsePackage(args, nil)
+	if *spec != "" {
+		g.ParseSpec(*spec, nil)
+	}
 
 	g.Generate()
 
@@ -0,0 +1,96 @@
+// Package storage 生成代码使用的上传文件存储
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Storage 上传文件存储
+type Storage interface {
+	// Save 保存文件 name为上传的文件名 返回保存后的地址
+	Save(name string, r io.Reader) (string, error)
+}
+
+// Default 生成代码使用的存储 可以在启动时替换
+var Default Storage = Local{Dir: "uploads", URL: "/uploads"}
+
+// Save 将上传的文件保存到存储
+func Save(s Storage, fh *multipart.FileHeader) (string, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return s.Save(fh.Filename, f)
+}
+
+// Remover 支持删除文件的存储
+type Remover interface {
+	// Remove 删除 Save 返回的地址对应的文件
+	Remove(u string) error
+}
+
+// Remove 删除已保存的文件 用于事务失败时清理 存储未实现 Remover 时忽略
+func Remove(s Storage, us ...string) error {
+	r, ok := s.(Remover)
+	if !ok {
+		return nil
+	}
+	var err error
+	for _, u := range us {
+		if e := r.Remove(u); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Local 本地目录存储
+type Local struct {
+	Dir string // 保存目录
+	URL string // 访问地址前缀 为空时返回文件名
+}
+
+// Save 以随机文件名保存 保留扩展名
+func (l Local) Save(name string, r io.Reader) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	key := hex.EncodeToString(b) + strings.ToLower(filepath.Ext(filepath.Base(name)))
+
+	if err := os.MkdirAll(l.Dir, os.ModePerm); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(filepath.Join(l.Dir, key), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	if l.URL == "" {
+		return key, nil
+	}
+	return strings.TrimRight(l.URL, "/") + "/" + key, nil
+}
+
+// Remove 删除文件 文件不存在时忽略
+func (l Local) Remove(u string) error {
+	err := os.Remove(filepath.Join(l.Dir, filepath.Base(u)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
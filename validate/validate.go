@@ -0,0 +1,172 @@
+// Package validate 生成代码使用的参数校验
+package validate
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	emailRe = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+	uuidRe  = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+	patterns sync.Map // pattern -> *regexp.Regexp
+)
+
+// Error 单个参数错误
+type Error struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Errors 参数错误列表
+type Errors []Error
+
+func (e Errors) Error() string {
+	s := make([]string, len(e))
+	for i, v := range e {
+		s[i] = v.Field + ": " + v.Message
+	}
+	return strings.Join(s, "; ")
+}
+
+// Validator 收集所有参数错误
+type Validator struct {
+	Errors Errors
+}
+
+// Add 添加错误
+func (v *Validator) Add(field, rule, format string, args ...interface{}) {
+	v.Errors = append(v.Errors, Error{Field: field, Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+// MaxLength 最大长度 按字符计算
+func (v *Validator) MaxLength(field, s string, n int) {
+	if utf8.RuneCountInString(s) > n {
+		v.Add(field, "maxlength", "length must be at most %d", n)
+	}
+}
+
+// MinLength 最小长度 按字符计算
+func (v *Validator) MinLength(field, s string, n int) {
+	if utf8.RuneCountInString(s) < n {
+		v.Add(field, "minlength", "length must be at least %d", n)
+	}
+}
+
+// Max 最大值
+func (v *Validator) Max(field string, x, n float64) {
+	if x > n {
+		v.Add(field, "max", "must be at most %v", n)
+	}
+}
+
+// Min 最小值
+func (v *Validator) Min(field string, x, n float64) {
+	if x < n {
+		v.Add(field, "min", "must be at least %v", n)
+	}
+}
+
+// Enums 枚举
+func (v *Validator) Enums(field string, x interface{}, enums ...string) {
+	s := fmt.Sprint(x)
+	for _, e := range enums {
+		if s == e {
+			return
+		}
+	}
+	v.Add(field, "enums", "must be one of %s", strings.Join(enums, ","))
+}
+
+// Pattern 正则
+func (v *Validator) Pattern(field, s, pattern string) {
+	re, ok := patterns.Load(pattern)
+	if !ok {
+		re = regexp.MustCompile(pattern)
+		patterns.Store(pattern, re)
+	}
+	if !re.(*regexp.Regexp).MatchString(s) {
+		v.Add(field, "pattern", "must match %s", pattern)
+	}
+}
+
+// Format 格式 email uuid url
+func (v *Validator) Format(field, s, format string) {
+	ok := true
+	switch format {
+	case "email":
+		ok = emailRe.MatchString(s)
+	case "uuid":
+		ok = uuidRe.MatchString(s)
+	case "url":
+		u, err := url.ParseRequestURI(s)
+		ok = err == nil && u.Scheme != "" && u.Host != ""
+	}
+	if !ok {
+		v.Add(field, "format", "must be a valid %s", format)
+	}
+}
+
+// File 上传文件 maxSize为0时不限制大小 mimes支持 image/*
+func (v *Validator) File(field string, fh *multipart.FileHeader, maxSize int64, mimes ...string) {
+	if maxSize > 0 && fh.Size > maxSize {
+		v.Add(field, "maxsize", "size must be at most %d bytes", maxSize)
+	}
+	if len(mimes) == 0 {
+		return
+	}
+	f, err := fh.Open()
+	if err != nil {
+		v.Add(field, "file", "%s", err.Error())
+		return
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	t := http.DetectContentType(buf[:n])
+	if i := strings.Index(t, ";"); i > -1 {
+		t = t[:i]
+	}
+	for _, m := range mimes {
+		if m == t || (strings.HasSuffix(m, "/*") && strings.HasPrefix(t, m[:len(m)-1])) {
+			return
+		}
+	}
+	v.Add(field, "mime", "type %s is not allowed, must be one of %s", t, strings.Join(mimes, ","))
+}
+
+// TimeMin 时间不早于 bound t为 time.Time 或 *time.Time
+func (v *Validator) TimeMin(field string, t interface{}, bound time.Time) {
+	if x, ok := times(t); ok && x.Before(bound) {
+		v.Add(field, "min", "must not be before %s", bound.Format(time.RFC3339))
+	}
+}
+
+// TimeMax 时间不晚于 bound
+func (v *Validator) TimeMax(field string, t interface{}, bound time.Time) {
+	if x, ok := times(t); ok && x.After(bound) {
+		v.Add(field, "max", "must not be after %s", bound.Format(time.RFC3339))
+	}
+}
+
+func times(t interface{}) (time.Time, bool) {
+	switch tt := t.(type) {
+	case time.Time:
+		return tt, true
+	case *time.Time:
+		if tt != nil {
+			return *tt, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,66 @@
+package validate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidator(t *testing.T) {
+	tests := []struct {
+		name string
+		f    func(v *Validator)
+		rule string
+	}{
+		{"maxlength ok", func(v *Validator) { v.MaxLength("a", "中文ab", 4) }, ""},
+		{"maxlength", func(v *Validator) { v.MaxLength("a", "中文abc", 4) }, "maxlength"},
+		{"minlength ok", func(v *Validator) { v.MinLength("a", "中文", 2) }, ""},
+		{"minlength", func(v *Validator) { v.MinLength("a", "中", 2) }, "minlength"},
+		{"max ok", func(v *Validator) { v.Max("a", 10, 10) }, ""},
+		{"max", func(v *Validator) { v.Max("a", 10.5, 10) }, "max"},
+		{"min ok", func(v *Validator) { v.Min("a", 0, 0) }, ""},
+		{"min", func(v *Validator) { v.Min("a", -1, 0) }, "min"},
+		{"enums ok", func(v *Validator) { v.Enums("a", 2, "1", "2") }, ""},
+		{"enums", func(v *Validator) { v.Enums("a", "c", "a", "b") }, "enums"},
+		{"pattern ok", func(v *Validator) { v.Pattern("a", "abc", "^[a-z]+$") }, ""},
+		{"pattern", func(v *Validator) { v.Pattern("a", "ab1", "^[a-z]+$") }, "pattern"},
+		{"email ok", func(v *Validator) { v.Format("a", "a@b.cn", "email") }, ""},
+		{"email", func(v *Validator) { v.Format("a", "a@b", "email") }, "format"},
+		{"uuid ok", func(v *Validator) { v.Format("a", "123e4567-e89b-12d3-a456-426614174000", "uuid") }, ""},
+		{"uuid", func(v *Validator) { v.Format("a", "123e4567", "uuid") }, "format"},
+		{"url ok", func(v *Validator) { v.Format("a", "https://a.com/x", "url") }, ""},
+		{"url", func(v *Validator) { v.Format("a", "/x", "url") }, "format"},
+		{"timemin ok", func(v *Validator) {
+			v.TimeMin("a", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		}, ""},
+		{"timemin", func(v *Validator) {
+			v.TimeMin("a", time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+		}, "min"},
+		{"timemax nil", func(v *Validator) { v.TimeMax("a", (*time.Time)(nil), time.Now()) }, ""},
+		{"timemax", func(v *Validator) {
+			x := time.Now().Add(time.Hour)
+			v.TimeMax("a", &x, time.Now())
+		}, "max"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &Validator{}
+			tt.f(v)
+			if tt.rule == "" {
+				if len(v.Errors) != 0 {
+					t.Fatalf("unexpected errors: %v", v.Errors)
+				}
+				return
+			}
+			if len(v.Errors) != 1 || v.Errors[0].Rule != tt.rule || v.Errors[0].Field != "a" {
+				t.Fatalf("want rule %s, got %v", tt.rule, v.Errors)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	e := Errors{{Field: "a", Message: "x"}, {Field: "b", Message: "y"}}
+	if e.Error() != "a: x; b: y" {
+		t.Fatalf("got %q", e.Error())
+	}
+}